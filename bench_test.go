@@ -0,0 +1,121 @@
+package latest
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func BenchmarkSubscribeFunc(b *testing.B) {
+	b.Run("routine-each", func(b *testing.B) {
+		benchmarkSubscribeFunc(b, 0)
+	})
+	b.Run("pool-4", func(b *testing.B) {
+		benchmarkSubscribeFunc(b, 4)
+	})
+}
+
+// benchmarkSubscribeFunc measures the latency of an Update until all of the
+// callbacks completed.
+func benchmarkSubscribeFunc(b *testing.B, workers int) {
+	const n = 1000
+	bc := Broadcast{Workers: workers}
+	defer bc.Close()
+
+	goroutines := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		bc.SubscribeFunc(func(interface{}) { wg.Done() })
+	}
+	goroutines = runtime.NumGoroutine() - goroutines
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(n)
+		bc.Update(i)
+		wg.Wait()
+	}
+	b.ReportMetric(float64(goroutines), "goroutines")
+}
+
+func BenchmarkFeed(b *testing.B) {
+	notify := make(chan interface{})
+	go func() {
+		for range notify {
+		}
+	}()
+	feed, exit := NewFeedErrs(notify)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		feed <- i
+	}
+
+	close(feed)
+	<-exit
+	close(notify)
+}
+
+func BenchmarkBroadcastUpdate(b *testing.B) {
+	for _, n := range []int{0, 1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("%d-subscribers", n), func(b *testing.B) {
+			var bc Broadcast
+			for i := 0; i < n; i++ {
+				notify := make(chan interface{})
+				bc.Subscribe(notify)
+				go func() {
+					for range notify {
+					}
+				}()
+				defer close(notify)
+				defer bc.UnsubscribeWait(notify)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bc.Update(i)
+			}
+		})
+	}
+}
+
+func BenchmarkSubscribeUnsubscribe(b *testing.B) {
+	var bc Broadcast
+	defer bc.Close()
+	notify := make(chan interface{})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bc.Subscribe(notify)
+		bc.Unsubscribe(notify)
+	}
+}
+
+// BenchmarkSubscriptionCount reads the count during ongoing updates.
+func BenchmarkSubscriptionCount(b *testing.B) {
+	var bc Broadcast
+	defer bc.Close()
+	for i := 0; i < 100; i++ {
+		bc.Subscribe(make(chan interface{}))
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				bc.Update(nil)
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bc.SubscriptionCount()
+	}
+}
@@ -0,0 +1,107 @@
+package latest
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// BreakerConfig tunes a circuit breaker.
+type BreakerConfig struct {
+	// Failures is the number of errors in a row which opens the breaker,
+	// with zero for 5.
+	Failures int
+	// Cooldown is the duration during which an open breaker skips delivery,
+	// with zero for one second.
+	Cooldown time.Duration
+}
+
+// BreakerState is the mode of a circuit breaker.
+type BreakerState int32
+
+// Circuit breaker states.
+const (
+	BreakerClosed   BreakerState = iota // delivery as usual
+	BreakerOpen                         // delivery skipped during cooldown
+	BreakerHalfOpen                     // next delivery probes recovery
+)
+
+// String returns the name of s.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker is the circuit breaker of a SubscribeForward.
+type Breaker struct {
+	untilNano int64 // end of cooldown in Unix nanoseconds; atomic access only
+	state     int32 // BreakerState; atomic access only
+
+	config   BreakerConfig
+	clock    Clock
+	failures int // errors in a row; owned by the callback
+}
+
+// State returns the current mode. An open breaker reports half-open once the
+// cooldown passed.
+func (br *Breaker) State() BreakerState {
+	s := BreakerState(atomic.LoadInt32(&br.state))
+	if s == BreakerOpen && !br.cooling() {
+		return BreakerHalfOpen
+	}
+	return s
+}
+
+// cooling returns whether the cooldown is in progress.
+func (br *Breaker) cooling() bool {
+	return br.clock.Now().UnixNano() < atomic.LoadInt64(&br.untilNano)
+}
+
+// forward passes v to send, when not cooling down, and it returns whether send
+// accepted.
+func (br *Breaker) forward(send func(interface{}) error, v interface{}) bool {
+	if BreakerState(atomic.LoadInt32(&br.state)) == BreakerOpen && br.cooling() {
+		return false
+	}
+
+	if err := send(v); err != nil {
+		br.failures++
+		if br.failures >= br.config.Failures {
+			// (re)open, including failed probes
+			atomic.StoreInt64(&br.untilNano, br.clock.Now().Add(br.config.Cooldown).UnixNano())
+			atomic.StoreInt32(&br.state, int32(BreakerOpen))
+		}
+		return false
+	}
+	br.failures = 0
+	atomic.StoreInt32(&br.state, int32(BreakerClosed))
+	return true
+}
+
+// SubscribeForward is like SubscribeFunc, yet for a fallible send. Errors in a
+// row open the breaker, after which delivery is skipped for a cooldown. The
+// first update after the cooldown probes send, which either closes the breaker
+// on success, or opens it once more on error. Values which are skipped or
+// rejected count as drops. Cancel terminates the subscription. The error is
+// ErrClosed after Close.
+func (b *Broadcast) SubscribeForward(send func(interface{}) error, config BreakerConfig) (br *Breaker, cancel func(), err error) {
+	if config.Failures <= 0 {
+		config.Failures = 5
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = time.Second
+	}
+	br = &Breaker{config: config, clock: clockOrSystem(b.Clock)}
+
+	cancel, err = b.subscribeCallback(func(v interface{}) bool {
+		return br.forward(send, v)
+	}, false)
+	return br, cancel, err
+}
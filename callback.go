@@ -0,0 +1,318 @@
+package latest
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SubscribeFunc adds an update receiver in the form of a callback. Slow
+// callbacks get the latest value only, as with NewFeed. Invocation is
+// sequential per subscription. Callbacks run on a routine of their own by
+// default, or on a shared pool when Workers is set. DeliveryJitter does not
+// apply to callbacks. Cancel terminates the subscription. The error is
+// ErrClosed after Close.
+func (b *Broadcast) SubscribeFunc(f func(interface{})) (cancel func(), err error) {
+	return b.subscribeCallback(func(v interface{}) bool {
+		f(v)
+		return true
+	}, false)
+}
+
+// Sink is a delivery target other than a channel, such as a ring buffer or a
+// connection wrapper.
+type Sink[T any] interface {
+	// Deliver passes v, and it returns whether v was accepted.
+	Deliver(v T) (accepted bool)
+}
+
+// SubscribeSink is like SubscribeFunc on b, yet updates go to sink. Values
+// which are not accepted by sink are discarded, as counted by Stats, and the
+// next update is tried as usual. Values which are not a T, including nil, are
+// discarded likewise, as with Recv.
+func SubscribeSink[T any](b *Broadcast, sink Sink[T]) (cancel func(), err error) {
+	return b.subscribeCallback(func(v interface{}) bool {
+		t, ok := v.(T)
+		return ok && sink.Deliver(t)
+	}, false)
+}
+
+// subscribeCallback implements SubscribeFunc and SubscribeSink. Current
+// delivers the version in place, if any, as the first.
+func (b *Broadcast) subscribeCallback(f func(interface{}) bool, current bool) (cancel func(), err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.addCallback(f, current)
+	if err != nil {
+		return func() {}, err
+	}
+	return func() { b.Unsubscribe(s.notify) }, nil
+}
+
+// addCallback registers f, as with subscribeCallback. The caller must hold the
+// write lock.
+func (b *Broadcast) addCallback(f func(interface{}) bool, current bool) (*subscription, error) {
+	key := make(chan interface{}) // identity only
+	s, err := b.subscribe(key, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.cb = &callback{s: s, f: f}
+	if b.Workers > 0 {
+		if b.pool == nil {
+			b.pool = newPool(b.Workers, s.spawn)
+		}
+		s.cb.pool = b.pool
+	} else {
+		s.cb.wake = make(chan struct{}, 1)
+		s.spawn(s.cb.run)
+	}
+	if current && b.hasLatest {
+		b.send(s, message{v: b.latest, at: b.at})
+	}
+	return s, nil
+}
+
+// callback is the delivery of a SubscribeFunc.
+type callback struct {
+	s *subscription
+	f func(interface{}) (accepted bool)
+
+	pool *pool         // shared routines, if any
+	wake chan struct{} // signals a routine of its own otherwise
+
+	mutex   sync.Mutex
+	m       message // latest input
+	pending bool    // whether m is undelivered
+	running bool    // whether an invocation is in progress
+	active  bool    // whether scheduled or running on pool
+	stopped bool    // whether terminated
+
+	drained chan struct{} // closed when idle, if requested
+}
+
+// deliver submits m.
+func (c *callback) deliver(m message) {
+	if m.ack != nil {
+		m.ack <- false // no direct delivery
+	}
+
+	c.mutex.Lock()
+	if m.clear {
+		c.m.settle(false)
+		c.m, c.pending = message{}, false
+		c.mutex.Unlock()
+		return
+	}
+	if c.pending {
+		c.s.coalesced()
+		c.m.settle(false)
+	}
+	c.m, c.pending = m, true
+	schedule := c.pool != nil && !c.active
+	if schedule {
+		c.active = true
+	}
+	c.mutex.Unlock()
+
+	switch {
+	case schedule:
+		c.pool.schedule(c)
+	case c.pool == nil:
+		select {
+		case c.wake <- struct{}{}:
+		default: // wake pending
+		}
+	}
+}
+
+// take returns the pending input, if any.
+func (c *callback) take() (m message, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	m, ok = c.m, c.pending && !c.stopped
+	c.m, c.pending = message{}, false
+	c.running = ok
+	return
+}
+
+// finish ends an invocation from take.
+func (c *callback) finish() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.running = false
+	if !c.pending {
+		if c.drained != nil {
+			close(c.drained)
+			c.drained = nil
+		}
+		c.s.caughtUp.emit()
+	}
+}
+
+// drain returns a channel which is closed once c has no input pending, and no
+// invocation in progress.
+func (c *callback) drain() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stopped || !c.pending && !c.running {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+	}
+	return c.drained
+}
+
+// idle returns whether c has no input pending, and no invocation in progress.
+func (c *callback) idle() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stopped || !c.pending && !c.running
+}
+
+// invoke applies m to the callback.
+func (c *callback) invoke(m message) {
+	if c.s.maxAge > 0 && c.s.clock.Now().Sub(m.at) > c.s.maxAge {
+		atomic.AddUint64(&c.s.drops, 1)
+		m.settle(false)
+		return
+	}
+	v := m.v
+	if c.s.clone != nil {
+		v = c.s.clone(v)
+	}
+	if !c.f(v) {
+		atomic.AddUint64(&c.s.drops, 1)
+		m.settle(false)
+		return
+	}
+	c.s.countDelivery()
+	c.s.events.emit(EventDelivered, c.s.notify)
+	m.settle(true)
+}
+
+// stop terminates c.
+func (c *callback) stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stopped = true
+	c.m.settle(false)
+	c.m, c.pending = message{}, false
+	if c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
+	if c.pool != nil && !c.active {
+		close(c.s.exited)
+	}
+}
+
+// run is the routine of a callback without pool.
+func (c *callback) run() {
+	defer close(c.s.exited)
+
+	for {
+		select {
+		case <-c.wake:
+			if m, ok := c.take(); ok {
+				c.invoke(m)
+				c.finish()
+			}
+		case <-c.s.done:
+			return
+		}
+	}
+}
+
+// step does one invocation on pool, at most.
+func (c *callback) step() {
+	if m, ok := c.take(); ok {
+		c.invoke(m)
+		c.finish()
+	}
+
+	c.mutex.Lock()
+	again := c.pending && !c.stopped
+	if !again {
+		c.active = false
+		if c.stopped {
+			close(c.s.exited)
+		}
+	}
+	c.mutex.Unlock()
+
+	if again {
+		c.pool.schedule(c) // to the back of the line
+	}
+}
+
+// pool runs callbacks on a fixed number of routines.
+type pool struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond  // signals ready or stopped
+	ready   []*callback // scheduled
+	stopped bool
+}
+
+func newPool(workers int, spawn func(f func())) *pool {
+	p := new(pool)
+	p.cond = sync.NewCond(&p.mutex)
+	for i := 0; i < workers; i++ {
+		spawn(p.work)
+	}
+	return p
+}
+
+func (p *pool) schedule(c *callback) {
+	p.mutex.Lock()
+	p.ready = append(p.ready, c)
+	p.mutex.Unlock()
+	p.cond.Signal()
+}
+
+func (p *pool) stop() {
+	p.mutex.Lock()
+	p.stopped = true
+	dropped := p.ready
+	p.ready = nil
+	p.mutex.Unlock()
+	p.cond.Broadcast()
+
+	// scheduled callbacks never step
+	for _, c := range dropped {
+		c.mutex.Lock()
+		c.active = false
+		if c.stopped {
+			close(c.s.exited)
+		}
+		c.mutex.Unlock()
+	}
+}
+
+func (p *pool) work() {
+	p.mutex.Lock()
+	for {
+		for len(p.ready) == 0 && !p.stopped {
+			p.cond.Wait()
+		}
+		if p.stopped {
+			p.mutex.Unlock()
+			return
+		}
+		c := p.ready[0]
+		p.ready[0] = nil // release
+		p.ready = p.ready[1:]
+		p.mutex.Unlock()
+
+		c.step()
+
+		p.mutex.Lock()
+	}
+}
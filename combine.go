@@ -0,0 +1,324 @@
+package latest
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Tagged is a value with its origin.
+type Tagged struct {
+	Source int         // index of origin
+	Value  interface{} // update
+}
+
+// SubscribeAny delivers the updates of all sources to notify as Tagged, with
+// the index in sources as the Source. Slow receivers get the latest Tagged
+// only, as with NewFeed. Sources closed already are ignored. Cancel ends all
+// subscriptions and the delivery.
+func SubscribeAny(notify chan<- interface{}, sources ...*Broadcast) (cancel func()) {
+	cases := make([]reflect.SelectCase, len(sources)+1)
+	chans := make([]chan interface{}, len(sources))
+	for i, b := range sources {
+		chans[i] = make(chan interface{})
+		b.Subscribe(chans[i])
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(chans[i])}
+	}
+	stop := make(chan struct{})
+	cases[len(sources)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)}
+
+	go func() {
+		feed := NewFeed(notify)
+		defer close(feed)
+
+		for {
+			chosen, v, _ := reflect.Select(cases)
+			if chosen == len(sources) {
+				return // cancelled
+			}
+			feed <- Tagged{Source: chosen, Value: v.Interface()}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for i, b := range sources {
+				b.Unsubscribe(chans[i])
+			}
+			close(stop)
+		})
+	}
+}
+
+// Derive returns a new Broadcast which tracks src, with f applied to each
+// version. The current version of src, if any, is applied before return.
+// Close on the derived Broadcast ends its subscription to src.
+func Derive(src *Broadcast, f func(interface{}) interface{}) *Broadcast {
+	derived := new(Broadcast)
+
+	notify := make(chan interface{})
+	current, ok := src.SubscribeLatest(notify)
+	if ok {
+		derived.Update(f(current))
+	}
+
+	stop := make(chan struct{})
+	derived.onClose = append(derived.onClose, func() {
+		src.Unsubscribe(notify)
+		close(stop)
+	})
+
+	go func() {
+		for {
+			select {
+			case v := <-notify:
+				derived.Update(f(v))
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return derived
+}
+
+// Bind updates b with each value received from src, until either src is
+// closed, or b is closed, or stop is called.
+func (b *Broadcast) Bind(src <-chan interface{}) (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case v, ok := <-src:
+				if !ok || b.Update(v) == ErrClosed {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// SubscribeBroadcast forwards each update of b to child, such that broadcasts
+// form a tree. The current version of b at the moment of subscription is not
+// forwarded. Values rejected by child, e.g., on Validate, count as drops of b.
+// Cancel ends the bridge, and so does Close on child. The error is ErrClosed
+// when either b or child is closed. Close on b may discard an update which is
+// in transit to child. Use CloseTree for an ordered shutdown instead.
+func (b *Broadcast) SubscribeBroadcast(child *Broadcast) (cancel func(), err error) {
+	b.Lock()
+	s, err := b.addCallback(func(v interface{}) bool {
+		return child.Update(v) == nil
+	}, false)
+	if err != nil {
+		b.Unlock()
+		return func() {}, err
+	}
+	s.child = child
+	b.Unlock()
+	cancel = func() { b.Unsubscribe(s.notify) }
+
+	child.Lock()
+	defer child.Unlock()
+	if child.closed {
+		cancel()
+		return func() {}, ErrClosed
+	}
+	child.onClose = append(child.onClose, cancel)
+	return cancel, nil
+}
+
+// CloseTree is like Close, yet with a deterministic shutdown order for the
+// children from SubscribeBroadcast. Updates fail with ErrClosed from the start.
+// Any update in transit to a child is forwarded first. Then each child gets
+// closed with CloseTree, in fan-out order, and b terminates last. Thus, each
+// child has the final version of its parent, unless rejected, by the time it
+// closes, and the leaves close before their roots. The tree must be free of
+// cycles. Subscriptions other than the bridges are terminated with b.
+func (b *Broadcast) CloseTree() {
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return
+	}
+	b.closed = true
+	var children []*Broadcast
+	var drains []<-chan struct{}
+	for _, s := range b.order {
+		if s.child != nil {
+			children = append(children, s.child)
+			drains = append(drains, s.cb.drain())
+		}
+	}
+	b.Unlock()
+
+	for _, c := range drains {
+		<-c
+	}
+	for _, child := range children {
+		child.CloseTree()
+	}
+
+	b.Lock()
+	hooks := b.shutdown()
+	b.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// FeedFromBroadcast subscribes to b with a new channel, starting with the
+// current version, if any. Slow receivers get the latest only, as with NewFeed.
+// The channel is closed once the subscription terminates, i.e., on cancel or
+// on Close of b, such that range loops end naturally. A b which is closed
+// already gives a closed channel.
+func FeedFromBroadcast(b *Broadcast) (notify <-chan interface{}, cancel func()) {
+	c := make(chan interface{})
+
+	b.Lock()
+	s, err := b.subscribe(c, 0)
+	if err != nil {
+		b.Unlock()
+		close(c)
+		return c, func() {}
+	}
+	if b.hasLatest {
+		s.replay = append(s.replay, b.latest)
+	}
+	s.spawn(s.run)
+	s.spawn(func() {
+		<-s.exited
+		close(c) // no more sends
+	})
+	b.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() { b.Unsubscribe(c) })
+	}
+}
+
+// BroadcastFromFeed returns a new Broadcast which gets an Update for each value
+// received from update. The Broadcast is closed once update is closed. Values
+// received after Close on the Broadcast are discarded until update is closed,
+// such that the producer never blocks on an abandoned channel.
+func BroadcastFromFeed(update <-chan interface{}) *Broadcast {
+	b := new(Broadcast)
+	go func() {
+		defer b.Close()
+		for v := range update {
+			if b.Update(v) == ErrClosed {
+				Drain(update)
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// CombineLatest delivers a snapshot of the latest value per input name to
+// notify, each time any of the inputs receives. Snapshots are partial until
+// each input received at least once. Slow receivers get the latest snapshot
+// only, as with NewFeed. Delivery stops once all inputs are closed.
+func CombineLatest(notify chan<- map[string]interface{}, inputs map[string]<-chan interface{}) {
+	go combineLatest(notify, inputs, false)
+}
+
+// CombineLatestAll is like CombineLatest, yet delivery starts when each of the
+// inputs received at least once, such that snapshots are always complete.
+func CombineLatestAll(notify chan<- map[string]interface{}, inputs map[string]<-chan interface{}) {
+	go combineLatest(notify, inputs, true)
+}
+
+func combineLatest(notify chan<- map[string]interface{}, inputs map[string]<-chan interface{}, waitAll bool) {
+	names := make([]string, 0, len(inputs))
+	cases := make([]reflect.SelectCase, 0, len(inputs)+1)
+	for name, c := range inputs {
+		names = append(names, name)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c)})
+	}
+	// zero Chan disables the case
+	deliver := len(cases)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend})
+
+	latest := make(map[string]interface{}, len(inputs))
+	for open := len(inputs); open != 0; {
+		chosen, v, ok := reflect.Select(cases)
+		switch {
+		case chosen == deliver:
+			cases[deliver].Chan = reflect.Value{}
+			cases[deliver].Send = reflect.Value{}
+			continue
+		case !ok:
+			cases[chosen].Chan = reflect.Value{}
+			open--
+			continue
+		}
+
+		latest[names[chosen]] = v.Interface()
+		if waitAll && len(latest) < len(inputs) {
+			continue
+		}
+		snapshot := make(map[string]interface{}, len(latest))
+		for name, v := range latest {
+			snapshot[name] = v
+		}
+		cases[deliver].Chan = reflect.ValueOf(notify)
+		cases[deliver].Send = reflect.ValueOf(snapshot)
+	}
+}
+
+// MergeLatestPerSource delivers the values of all inputs to notify. Slow
+// receivers get the latest value of each input which received in the mean
+// time, one by one, in round-robin order. Busy inputs can not starve quiet
+// ones as such. Delivery stops once all inputs are closed.
+func MergeLatestPerSource(notify chan<- interface{}, inputs ...<-chan interface{}) {
+	cases := make([]reflect.SelectCase, len(inputs)+1)
+	for i, c := range inputs {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c)}
+	}
+	// zero Chan disables the case
+	deliver := len(inputs)
+	cases[deliver] = reflect.SelectCase{Dir: reflect.SelectSend}
+
+	go func() {
+		latest := make([]interface{}, len(inputs))
+		pending := make([]bool, len(inputs))
+		var next int // round-robin position
+
+		for open := len(inputs); open != 0; {
+			// pick the next pending input
+			var pick int
+			cases[deliver].Chan = reflect.Value{}
+			for i := 0; i < len(inputs); i++ {
+				pick = (next + i) % len(inputs)
+				if pending[pick] {
+					cases[deliver].Chan = reflect.ValueOf(notify)
+					cases[deliver].Send = reflect.ValueOf(&latest[pick]).Elem()
+					break
+				}
+			}
+
+			chosen, v, ok := reflect.Select(cases)
+			switch {
+			case chosen == deliver:
+				pending[pick] = false
+				latest[pick] = nil // release
+				next = pick + 1
+			case !ok:
+				cases[chosen].Chan = reflect.Value{}
+				open--
+			default:
+				latest[chosen] = v.Interface()
+				pending[chosen] = true
+			}
+		}
+	}()
+}
@@ -0,0 +1,67 @@
+package latest
+
+import "sync"
+
+// DualBroadcast tracks both the latest attempted and the latest successful
+// version, e.g., of a deployment. The zero value is ready to use. Multiple
+// goroutines may invoke methods on a DualBroadcast simultaneously.
+type DualBroadcast struct {
+	mutex     sync.Mutex // serializes updates
+	attempted Broadcast
+	succeeded Broadcast
+}
+
+// UpdateAttempt sets the latest attempted version.
+func (d *DualBroadcast) UpdateAttempt(v interface{}) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.attempted.Update(v)
+}
+
+// UpdateSuccess sets the latest successful version.
+func (d *DualBroadcast) UpdateSuccess(v interface{}) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.succeeded.Update(v)
+}
+
+// Load returns both versions from the same snapshot, with nil for none.
+func (d *DualBroadcast) Load() (attempted, succeeded interface{}) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	attempted, _ = d.attempted.Load()
+	succeeded, _ = d.succeeded.Load()
+	return
+}
+
+// SubscribeAttempt adds a receiver of attempted versions.
+func (d *DualBroadcast) SubscribeAttempt(notify chan<- interface{}) error {
+	return d.attempted.Subscribe(notify)
+}
+
+// SubscribeSuccess adds a receiver of successful versions.
+func (d *DualBroadcast) SubscribeSuccess(notify chan<- interface{}) error {
+	return d.succeeded.Subscribe(notify)
+}
+
+// UnsubscribeAttempt terminates a SubscribeAttempt.
+func (d *DualBroadcast) UnsubscribeAttempt(notify chan<- interface{}) {
+	d.attempted.Unsubscribe(notify)
+}
+
+// UnsubscribeSuccess terminates a SubscribeSuccess.
+func (d *DualBroadcast) UnsubscribeSuccess(notify chan<- interface{}) {
+	d.succeeded.Unsubscribe(notify)
+}
+
+// Close terminates all subscriptions, as described by Broadcast.Close.
+func (d *DualBroadcast) Close() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.attempted.Close()
+	d.succeeded.Close()
+}
@@ -0,0 +1,78 @@
+package latest
+
+import "sync/atomic"
+
+// EventKind classifies a FeedEvent.
+type EventKind int
+
+// Subscription events.
+const (
+	EventDelivered EventKind = iota + 1 // value passed to the subscriber
+	EventCoalesced                      // pending value replaced by a newer one
+	EventClosed                         // subscription terminated
+	EventEvicted                        // subscription terminated on MaxSubscribers
+)
+
+// String returns the name of k.
+func (k EventKind) String() string {
+	switch k {
+	case EventDelivered:
+		return "delivered"
+	case EventCoalesced:
+		return "coalesced"
+	case EventClosed:
+		return "closed"
+	case EventEvicted:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// FeedEvent is a debug record of a subscription.
+type FeedEvent struct {
+	Kind EventKind
+	// Notify identifies the subscriber by its channel. Callbacks from
+	// SubscribeFunc have an internal channel, for identity only.
+	Notify chan<- interface{}
+}
+
+// eventBuffer is the capacity of the Events channel.
+const eventBuffer = 64
+
+// Events returns a channel which receives each FeedEvent of the subscriptions.
+// Events are discarded when the channel is full, such that slow receivers can't
+// stall any delivery. Event recording is off until the first invocation. All
+// invocations return the same channel. The channel is never closed.
+func (b *Broadcast) Events() <-chan FeedEvent {
+	b.Lock()
+	defer b.Unlock()
+
+	c, _ := b.events.c.Load().(chan FeedEvent)
+	if c == nil {
+		c = make(chan FeedEvent, eventBuffer)
+		b.events.c.Store(c)
+	}
+	return c
+}
+
+// eventLog is the Events destination.
+type eventLog struct {
+	c atomic.Value // chan FeedEvent, if any
+}
+
+// emit records an event, if enabled and if buffer space is available.
+func (l *eventLog) emit(kind EventKind, notify chan<- interface{}) {
+	if l == nil {
+		return
+	}
+	c, _ := l.c.Load().(chan FeedEvent)
+	if c == nil {
+		return
+	}
+	select {
+	case c <- FeedEvent{Kind: kind, Notify: notify}:
+	default:
+		break // discard
+	}
+}
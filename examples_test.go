@@ -1,7 +1,17 @@
 package latest_test
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/pascaldekloe/latest"
 )
@@ -60,3 +70,908 @@ func ExampleBroadcast() {
 	// subscription 1 got 5th update
 	// subscription 2 got 5th update
 }
+
+func ExampleBroadcast_SubscribeLatest() {
+	var b latest.Broadcast
+	defer b.UnsubscribeAll()
+
+	b.Update("v1")
+
+	notify := make(chan interface{})
+	current, ok := b.SubscribeLatest(notify)
+	fmt.Println("current", current, ok)
+
+	b.Update("v2")
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// current v1 true
+	// got v2
+}
+
+func ExampleBroadcast_Pause() {
+	var b latest.Broadcast
+	defer b.UnsubscribeAll()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+
+	b.Pause()
+	b.Update("held 1")
+	b.Update("held 2")
+	b.Resume()
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got held 2
+}
+
+func ExampleSignal() {
+	var s latest.Signal
+
+	// register 2 waiters
+	c1, c2 := s.C(), s.C()
+
+	s.Trigger()
+	s.Trigger() // coalesced
+	<-c1
+	<-c2
+	fmt.Println("both woke up")
+
+	// Output:
+	// both woke up
+}
+
+func ExampleBroadcast_Validate() {
+	b := latest.Broadcast{
+		Validate: func(v interface{}) error {
+			if v == nil {
+				return errors.New("nil version")
+			}
+			return nil
+		},
+	}
+
+	fmt.Println("update error:", b.Update(nil))
+	_, ok := b.SubscribeLatest(make(chan interface{}))
+	fmt.Println("got current:", ok)
+	b.Close()
+
+	// Output:
+	// update error: nil version
+	// got current: false
+}
+
+func ExampleSubscribeAny() {
+	var config, secrets latest.Broadcast
+
+	notify := make(chan interface{})
+	cancel := latest.SubscribeAny(notify, &config, &secrets)
+	defer cancel()
+
+	secrets.Update("rotated")
+	fmt.Printf("got %+v\n", <-notify)
+	config.Update("reloaded")
+	fmt.Printf("got %+v\n", <-notify)
+
+	// Output:
+	// got {Source:1 Value:rotated}
+	// got {Source:0 Value:reloaded}
+}
+
+func ExampleDerive() {
+	var celsius latest.Broadcast
+	celsius.Update(20.0)
+
+	fahrenheit := latest.Derive(&celsius, func(v interface{}) interface{} {
+		return v.(float64)*9/5 + 32
+	})
+	// unsubscribes from celsius
+	defer fahrenheit.Close()
+
+	notify := make(chan interface{})
+	current, _ := fahrenheit.SubscribeLatest(notify)
+	fmt.Println("current", current)
+
+	celsius.Update(100.0)
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// current 68
+	// got 212
+}
+
+func ExampleNewKeyedFeed() {
+	notify := make(chan interface{})
+	update := latest.NewKeyedFeed(notify, func(v interface{}) string {
+		return strings.SplitN(v.(string), "=", 2)[0]
+	})
+	defer close(update)
+
+	update <- "host=a"
+	update <- "port=80"
+	update <- "host=b"
+
+	fmt.Println("got", <-notify)
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got host=b
+	// got port=80
+}
+
+func ExampleBroadcast_WaitFor() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	go func() {
+		for version := 1; version <= 5; version++ {
+			b.Update(version)
+		}
+	}()
+
+	v, err := b.WaitFor(context.Background(), func(v interface{}) bool {
+		return v.(int) >= 5
+	})
+	fmt.Println("got", v, err)
+
+	// Output:
+	// got 5 <nil>
+}
+
+func ExampleFeeder() {
+	// code under test depends on an interface
+	publish := func(f latest.Feeder) {
+		f.Send("v1")
+		f.Send("v2")
+	}
+
+	notify := make(chan interface{})
+	feed := latest.NewFeed(notify)
+	defer feed.Close()
+
+	publish(feed)
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got v2
+}
+
+func ExampleNewSyncFeed() {
+	publish := func(f latest.Feeder) {
+		f.Send("v1")
+		f.Send("v2")
+		f.Close()
+	}
+
+	notify := make(chan interface{})
+	go publish(latest.NewSyncFeed(notify))
+	for v := range notify {
+		fmt.Println("got", v)
+	}
+
+	// Output:
+	// got v1
+	// got v2
+}
+
+func ExampleBroadcast_Seq() {
+	var b latest.Broadcast
+	b.Update("v1")
+	b.Update("v2")
+	b.Close()
+	b.Update("rejected")
+	fmt.Println("seq", b.Seq())
+
+	// Output:
+	// seq 2
+}
+
+func ExampleBroadcast_Bind() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+
+	src := make(chan interface{})
+	stop := b.Bind(src)
+	defer stop()
+
+	src <- "from producer"
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got from producer
+}
+
+func ExampleCombineLatestAll() {
+	host := make(chan interface{})
+	port := make(chan interface{})
+	defer close(host)
+	defer close(port)
+
+	notify := make(chan map[string]interface{})
+	latest.CombineLatestAll(notify, map[string]<-chan interface{}{
+		"host": host,
+		"port": port,
+	})
+
+	host <- "example.com"
+	host <- "example.org"
+	port <- 443
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got map[host:example.org port:443]
+}
+
+func ExampleBroadcast_Clone() {
+	b := latest.Broadcast{
+		Clone: func(v interface{}) interface{} {
+			return append([]string(nil), v.([]string)...)
+		},
+	}
+	defer b.Close()
+
+	notify1 := make(chan interface{})
+	notify2 := make(chan interface{})
+	b.Subscribe(notify1)
+	b.Subscribe(notify2)
+
+	b.Update([]string{"a", "b"})
+	got1 := (<-notify1).([]string)
+	got1[0] = "mutated"
+	fmt.Println("subscription 2 got", <-notify2)
+
+	// Output:
+	// subscription 2 got [a b]
+}
+
+func ExampleBroadcast_Mute() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+
+	b.Update("v1")
+	b.Mute(notify) // discards v1
+	b.Update("v2")
+	b.Update("v3")
+	b.Unmute(notify)
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got v3
+}
+
+func ExampleBroadcast_PublishExpvar() {
+	var b latest.Broadcast
+	defer b.Close()
+	b.PublishExpvar("example_version")
+
+	b.Update("v1.2.3")
+	fmt.Println(expvar.Get("example_version"))
+
+	// Output:
+	// {"drops":0,"subscriptions":0,"updates":1,"value":"v1.2.3"}
+}
+
+func ExampleBroadcast_LoadOrWait() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	fmt.Println("got", b.LoadOrWait(ctx, "default"))
+
+	b.Update("configured")
+	fmt.Println("got", b.LoadOrWait(ctx, "default"))
+
+	// Output:
+	// got default
+	// got configured
+}
+
+func ExampleBroadcast_HistorySnapshot() {
+	b := latest.Broadcast{History: 3}
+	for version := 1; version <= 5; version++ {
+		b.Update(version)
+	}
+	fmt.Println(b.HistorySnapshot())
+
+	// Output:
+	// [3 4 5]
+}
+
+func ExampleBroadcast_ReadOnly() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	// consumer can not update
+	var view latest.Subscriber = b.ReadOnly()
+	notify := make(chan interface{})
+	view.Subscribe(notify)
+
+	b.Update("v1")
+	fmt.Println("got", <-notify)
+	_, ok := view.(*latest.Broadcast)
+	fmt.Println("revealed:", ok)
+
+	// Output:
+	// got v1
+	// revealed: false
+}
+
+func ExampleBroadcast_SubscribeFunc() {
+	// callbacks share 2 routines
+	b := latest.Broadcast{Workers: 2}
+	defer b.Close()
+
+	done := make(chan struct{})
+	cancel, _ := b.SubscribeFunc(func(v interface{}) {
+		fmt.Println("got", v)
+		close(done)
+	})
+	defer cancel()
+
+	b.Update("v1")
+	<-done
+
+	// Output:
+	// got v1
+}
+
+func ExampleNewBroadcast() {
+	b := latest.NewBroadcast(
+		latest.WithHistory(2),
+		latest.WithSendTimeout(time.Second),
+	)
+	defer b.Close()
+
+	b.Update("v1")
+	b.Update("v2")
+	b.Update("v3")
+	fmt.Println(b.HistorySnapshot())
+
+	// Output:
+	// [v2 v3]
+}
+
+func ExampleMergeLatestPerSource() {
+	chatty := make(chan interface{})
+	quiet := make(chan interface{})
+	defer close(chatty)
+	defer close(quiet)
+
+	notify := make(chan interface{})
+	latest.MergeLatestPerSource(notify, chatty, quiet)
+
+	quiet <- "quiet 1"
+	chatty <- "chatty 1"
+	chatty <- "chatty 2"
+	chatty <- "chatty 3"
+	fmt.Println("got", <-notify)
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got chatty 3
+	// got quiet 1
+}
+
+func ExampleDrain() {
+	notify := make(chan interface{})
+	go func() {
+		defer close(notify)
+		for i := 0; i < 3; i++ {
+			notify <- i
+		}
+	}()
+
+	fmt.Println("got", <-notify)
+	latest.Drain(notify) // unblocks the producer
+	fmt.Println("drained")
+
+	// Output:
+	// got 0
+	// drained
+}
+
+func ExamplePipe() {
+	in := make(chan interface{})
+	defer close(in)
+
+	notify := make(chan interface{})
+	latest.Pipe(in).
+		Filter(func(v interface{}) bool { return v.(int)%2 == 0 }).
+		Map(func(v interface{}) interface{} { return v.(int) * 10 }).
+		To(notify)
+
+	in <- 1
+	in <- 2
+	in <- 3
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got 20
+}
+
+func ExampleDualBroadcast() {
+	var deploys latest.DualBroadcast
+	defer deploys.Close()
+
+	deploys.UpdateAttempt("v1")
+	deploys.UpdateSuccess("v1")
+	deploys.UpdateAttempt("v2") // failed
+	fmt.Println(deploys.Load())
+
+	// Output:
+	// v2 v1
+}
+
+func ExampleBroadcast_UpdateGroup() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	eu := make(chan interface{})
+	us := make(chan interface{})
+	b.SubscribeGroup(eu, "eu")
+	b.SubscribeGroup(us, "us")
+
+	b.UpdateGroup("eu", "eu maintenance")
+	fmt.Println("eu got", <-eu)
+	b.Update("global release")
+	fmt.Println("us got", <-us)
+
+	// Output:
+	// eu got eu maintenance
+	// us got global release
+}
+
+func ExampleNewFeedSentinel() {
+	notify := make(chan interface{})
+	feed := latest.NewFeedSentinel(notify)
+
+	feed <- nil
+	fmt.Println("got", <-notify)
+	close(feed)
+	if v := <-notify; v == latest.Closed {
+		fmt.Println("got", v)
+	}
+
+	// Output:
+	// got <nil>
+	// got latest.Closed
+}
+
+func ExampleNewMergeFeed() {
+	notify := make(chan interface{})
+	sum := func(acc, next interface{}) interface{} {
+		return acc.(int) + next.(int)
+	}
+	feed := latest.NewMergeFeed(notify, sum)
+	defer close(feed)
+
+	// receiver busy
+	feed <- 1
+	feed <- 2
+	feed <- 3
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got 6
+}
+
+func ExampleNewDeltaFeed() {
+	notify := make(chan interface{})
+	diff := func(prev, cur interface{}) interface{} {
+		return cur.(int) - prev.(int)
+	}
+	feed := latest.NewDeltaFeed(notify, diff)
+	defer close(feed)
+
+	feed <- 10
+	fmt.Println("got", <-notify)
+
+	// receiver busy
+	feed <- 12
+	feed <- 15
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got 10
+	// got 5
+}
+
+// LastN keeps the most recent values in a ring.
+type LastN struct {
+	ring []string
+	n    int
+	done chan struct{}
+}
+
+// Deliver implements latest.Sink.
+func (l *LastN) Deliver(v string) bool {
+	l.ring[l.n%len(l.ring)] = v
+	l.n++
+	if l.n == 3 {
+		close(l.done)
+	}
+	return true
+}
+
+func ExampleSubscribeSink() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	sink := &LastN{ring: make([]string, 2), done: make(chan struct{})}
+	latest.SubscribeSink[string](&b, sink)
+	for _, v := range []string{"a", "b", "c"} {
+		b.UpdateWait(v, time.Second)
+	}
+	<-sink.done
+	fmt.Println(sink.ring)
+
+	// Output:
+	// [c b]
+}
+
+func ExampleBroadcast_SubscribeBroadcast() {
+	var central, edge latest.Broadcast
+	defer central.Close()
+	central.SubscribeBroadcast(&edge)
+
+	local := make(chan interface{})
+	edge.Subscribe(local)
+	central.Update("config v2")
+	fmt.Println("edge got", <-local)
+
+	edge.Close()
+	fmt.Println("bridges:", central.SubscriptionCount())
+
+	// Output:
+	// edge got config v2
+	// bridges: 0
+}
+
+func ExampleConsumeRelay() {
+	conn, remoteConn := io.Pipe()
+
+	// local side
+	mirror, stop, errs := latest.ConsumeRelay(conn, func(p []byte) (interface{}, error) {
+		return string(p), nil
+	})
+	local := make(chan interface{})
+	mirror.Subscribe(local)
+
+	// remote side
+	var remote latest.Broadcast
+	defer remote.Close()
+	notify := make(chan interface{})
+	remote.Subscribe(notify)
+	go latest.Relay(remoteConn, notify, func(v interface{}) ([]byte, error) {
+		return []byte(v.(string)), nil
+	})
+
+	remote.Update("v1")
+	fmt.Println("mirror got", <-local)
+
+	remoteConn.Close()
+	fmt.Println("consume error:", <-errs)
+	stop()
+
+	// Output:
+	// mirror got v1
+	// consume error: <nil>
+}
+
+func ExampleBroadcast_SubscribeDistinct() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	notify := make(chan interface{}, 3)
+	b.SubscribeDistinct(notify, nil)
+	for _, v := range []string{"up", "up", "down", "down", "up"} {
+		b.UpdateWait(v, 10*time.Millisecond)
+	}
+	fmt.Println(<-notify, <-notify, <-notify)
+	fmt.Println(len(notify), "more")
+
+	// Output:
+	// up down up
+	// 0 more
+}
+
+func ExampleBroadcast_Batch() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	notify := make(chan interface{}, 10)
+	b.Subscribe(notify)
+	b.Batch(func(set func(interface{})) {
+		set("step 1")
+		set("step 2")
+		set("done")
+	})
+	fmt.Println(<-notify, "as version", b.Seq())
+
+	// Output:
+	// done as version 1
+}
+
+func ExampleNewFeedAutoClose() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	feed, output := latest.NewFeedAutoClose(ctx)
+	defer close(feed)
+
+	feed <- "first"
+	for v := range output {
+		fmt.Println("got", v)
+		cancel() // after the first
+	}
+	fmt.Println("output closed")
+
+	// Output:
+	// got first
+	// output closed
+}
+
+func ExampleBroadcast_SubscribeRelay() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	b.Update(make(chan int)) // not JSON
+	_, _, err := b.SubscribeRelay(ioutil.Discard, json.Marshal)
+	fmt.Println(err)
+
+	// Output:
+	// json: unsupported type: chan int
+}
+
+func ExampleBroadcast_ExportState() {
+	var old latest.Broadcast
+	old.Update("v1")
+	old.Update("v2")
+	old.Close()
+
+	// transfer, e.g., with encoding/gob
+	st := old.ExportState()
+
+	b := new(latest.Broadcast)
+	defer b.Close()
+	b.RestoreState(st)
+	current, seq, _, _ := b.State()
+	fmt.Println(current, "as version", seq)
+
+	// Output:
+	// v2 as version 2
+}
+
+func ExampleNewWarmupFeed() {
+	notify := make(chan interface{})
+	feed := latest.NewWarmupFeed(notify, 2)
+	defer close(feed)
+
+	feed <- "default"
+	feed <- "noise"
+	feed <- "stable"
+	fmt.Println("got", <-notify)
+
+	// Output:
+	// got stable
+}
+
+// PrintRegisterer lists metrics on registration.
+type PrintRegisterer struct{}
+
+func (PrintRegisterer) GaugeFunc(name, help string, f func() float64) error {
+	fmt.Printf("gauge %s = %g\n", name, f())
+	return nil
+}
+
+func (PrintRegisterer) CounterFunc(name, help string, f func() float64) error {
+	fmt.Printf("counter %s = %g\n", name, f())
+	return nil
+}
+
+func ExampleBroadcast_RegisterMetrics() {
+	var b latest.Broadcast
+	defer b.Close()
+	b.Subscribe(make(chan interface{}))
+
+	b.RegisterMetrics(PrintRegisterer{}, "config")
+
+	// Output:
+	// gauge config_subscriptions = 1
+	// counter config_updates_total = 0
+	// counter config_drops_total = 0
+	// gauge config_last_update_timestamp_seconds = 0
+}
+
+func ExampleNewFeedOnDrop() {
+	notify := make(chan interface{})
+	dropped := make(chan interface{}, 10)
+	feed := latest.NewFeedOnDrop(notify, func(v interface{}) {
+		dropped <- v
+	})
+	defer close(feed)
+
+	// receiver busy
+	feed <- "v1"
+	feed <- "v2"
+	feed <- "v3"
+	fmt.Println("got", <-notify)
+	fmt.Println("missed", <-dropped, <-dropped)
+
+	// Output:
+	// got v3
+	// missed v1 v2
+}
+
+func ExampleWatchInto() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	files := map[string]string{"app.conf": "debug=false"}
+	changes := make(chan struct{})
+	errs := latest.WatchInto(&b, changes, func() (interface{}, error) {
+		content, ok := files["app.conf"]
+		if !ok {
+			return nil, errors.New("app.conf missing")
+		}
+		return content, nil
+	})
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	changes <- struct{}{}
+	fmt.Println("loaded", <-notify)
+
+	delete(files, "app.conf")
+	changes <- struct{}{}
+	fmt.Println("error:", <-errs)
+	close(changes)
+
+	// Output:
+	// loaded debug=false
+	// error: app.conf missing
+}
+
+func ExampleNewThresholdFeed() {
+	notify := make(chan interface{})
+	feed := latest.NewThresholdFeed(notify, 0.5, func(v interface{}) float64 {
+		return v.(float64)
+	})
+	defer close(feed)
+
+	for _, celsius := range []float64{20.0, 20.1, 20.3, 21.0} {
+		feed <- celsius
+		if celsius == 20.0 || celsius == 21.0 {
+			fmt.Println("got", <-notify)
+		}
+	}
+
+	// Output:
+	// got 20
+	// got 21
+}
+
+// PrintLogger writes to standard output.
+type PrintLogger struct{}
+
+func (PrintLogger) Debugf(format string, args ...interface{}) {
+	fmt.Printf("DEBUG "+format+"\n", args...)
+}
+
+func (PrintLogger) Warnf(format string, args ...interface{}) {
+	fmt.Printf("WARN "+format+"\n", args...)
+}
+
+func ExampleLogger() {
+	b := latest.NewBroadcast(latest.WithLogger(PrintLogger{}))
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Unsubscribe(notify)
+	b.Close()
+
+	// Output:
+	// DEBUG latest: subscribe; 1 subscriptions
+	// DEBUG latest: unsubscribe; 0 subscriptions
+	// DEBUG latest: close with 0 subscriptions
+}
+
+func ExampleBroadcast_Reader() {
+	var b latest.Broadcast
+	b.Update("v1")
+
+	r := b.Reader(func(v interface{}) ([]byte, error) {
+		return []byte(v.(string) + "\n"), nil
+	})
+	defer r.Close()
+	go func() {
+		b.UpdateWait("v2", time.Second)
+		b.Close()
+	}()
+
+	// e.g., a chunked HTTP response
+	io.Copy(os.Stdout, r)
+
+	// Output:
+	// v1
+	// v2
+}
+
+func ExampleBroadcast_Swap() {
+	var b latest.Broadcast
+	defer b.Close()
+
+	b.Update([]string{"a", "b"})
+	next := []string{"b", "c"}
+	prev, _ := b.Swap(next)
+	fmt.Println("was", prev, "now", next)
+
+	// Output:
+	// was [a b] now [b c]
+}
+
+func ExampleFlagBroadcast() {
+	var healthy latest.FlagBroadcast
+	defer healthy.Close()
+
+	go healthy.Set(true) // before or during Wait
+	if err := healthy.Wait(context.Background(), true); err != nil {
+		fmt.Println("wait error:", err)
+		return
+	}
+	fmt.Println("healthy:", healthy.Get())
+
+	notify := make(chan bool)
+	healthy.Subscribe(notify)
+	healthy.Set(false)
+	fmt.Println("healthy:", <-notify)
+
+	// Output:
+	// healthy: true
+	// healthy: false
+}
+
+func ExampleFork() {
+	in := make(chan interface{})
+	// values go to out1 first
+	slow, fast := latest.Fork(in)
+
+	for i := 1; i <= 3; i++ {
+		in <- i
+		fmt.Println("fast got", <-fast)
+	}
+	fmt.Println("slow got", <-slow)
+	close(in)
+	latest.Drain(fast)
+	latest.Drain(slow)
+	fmt.Println("outputs closed")
+
+	// Output:
+	// fast got 1
+	// fast got 2
+	// fast got 3
+	// slow got 3
+	// outputs closed
+}
+
+func ExampleWriteJSONL() {
+	notify := make(chan interface{}, 2)
+	notify <- map[string]int{"replicas": 3}
+	notify <- map[string]int{"replicas": 5}
+	close(notify)
+
+	w := bufio.NewWriter(os.Stdout)
+	if err := latest.WriteJSONL(w, notify); err != nil {
+		fmt.Println("stream error:", err)
+	}
+
+	// Output:
+	// {"replicas":3}
+	// {"replicas":5}
+}
@@ -0,0 +1,543 @@
+package latest
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// NewKeyedFeed is like NewFeed, yet coalescing applies per key. Slow
+// receivers get the latest value of each key, in order of arrival.
+func NewKeyedFeed(notify chan<- interface{}, key func(interface{}) string) Feed {
+	feed := make(chan interface{})
+
+	go func() {
+		var order []string // pending keys
+		pending := make(map[string]interface{})
+
+		for {
+			var out chan<- interface{} // nil blocks
+			var next interface{}
+			if len(order) != 0 {
+				out = notify
+				next = pending[order[0]]
+			}
+
+			select {
+			case v, ok := <-feed:
+				if !ok {
+					return
+				}
+				k := key(v)
+				if _, ok := pending[k]; !ok {
+					order = append(order, k)
+				}
+				pending[k] = v
+
+			case out <- next:
+				delete(pending, order[0])
+				order = order[1:]
+			}
+		}
+	}()
+
+	return feed
+}
+
+// NewMergeFeed is like NewFeed, yet pending values get combined with merge,
+// instead of being replaced. The first value after a delivery starts a new
+// accumulation as is, without invocation of merge. Each next value is folded
+// as merge(acc, next) until the receiver catches up. NewFeed is equivalent to
+// a merge which returns next.
+func NewMergeFeed(notify chan<- interface{}, merge func(acc, next interface{}) interface{}) Feed {
+	feed := make(chan interface{})
+
+	go func() {
+		for {
+			// await update
+			acc, ok := <-feed
+			for {
+				if !ok {
+					return
+				}
+				var next interface{}
+				select {
+				case next, ok = <-feed:
+					if ok {
+						acc = merge(acc, next)
+					}
+					continue
+
+				case notify <- acc:
+					break // accumulation delivered
+				}
+				break
+			}
+		}
+	}()
+
+	return feed
+}
+
+// NewDeltaFeed is like NewFeed, yet the receiver gets sub(prev, cur) instead
+// of the value cur, with prev as the last value delivered. Deltas span any
+// values which were replaced before delivery thus. The first value has no
+// prev, and it is delivered as is, without invocation of sub, i.e., as a delta
+// from nothing. Sub runs on each value received, so it should be cheap.
+func NewDeltaFeed(notify chan<- interface{}, sub func(prev, cur interface{}) interface{}) Feed {
+	feed := make(chan interface{})
+
+	go func() {
+		var out chan<- interface{} // nil blocks
+		var cur, delta interface{} // pending value and its delta
+		var prev interface{}       // last value delivered
+		var hasPrev bool           // whether prev applies
+		for {
+			select {
+			case v, ok := <-feed:
+				if !ok {
+					return
+				}
+				cur, delta, out = v, v, notify
+				if hasPrev {
+					delta = sub(prev, v)
+				}
+
+			case out <- delta:
+				prev, hasPrev = cur, true
+				out, cur, delta = nil, nil, nil
+			}
+		}
+	}()
+
+	return feed
+}
+
+// PressureFeed is a Feed which reports whether its receiver lags behind.
+type PressureFeed struct {
+	Feed
+	pending int32 // atomic access only
+}
+
+// NewPressureFeed is like NewFeed, with Pressure for adaptive producers.
+func NewPressureFeed(notify chan<- interface{}) *PressureFeed {
+	feed := make(chan interface{})
+	f := &PressureFeed{Feed: feed}
+
+	go func() {
+		for {
+			// await update
+			latest, ok := <-feed
+			for {
+				if !ok {
+					atomic.StoreInt32(&f.pending, 0)
+					return
+				}
+				atomic.StoreInt32(&f.pending, 1)
+				select {
+				case latest, ok = <-feed:
+					continue // newer update
+
+				case notify <- latest:
+					atomic.StoreInt32(&f.pending, 0)
+				}
+				break
+			}
+		}
+	}()
+
+	return f
+}
+
+// Pressure returns 1 when the routine holds an undelivered value, i.e., when
+// the receiver is behind, and 0 otherwise. Producers may throttle on pressure.
+func (f *PressureFeed) Pressure() int {
+	return int(atomic.LoadInt32(&f.pending))
+}
+
+// NewFeedAutoClose is like NewFeed, yet the output channel is owned by the
+// routine. Output is closed once the input channel is closed, or once ctx is
+// done, whichever comes first, such that range loops on output end naturally.
+// Input after ctx is done is discarded until the input channel is closed.
+func NewFeedAutoClose(ctx context.Context) (feed Feed, output <-chan interface{}) {
+	in := make(chan interface{})
+	out := make(chan interface{})
+
+	go func() {
+		defer close(out)
+		for {
+			// await update
+			var latest interface{}
+			var ok bool
+			select {
+			case latest, ok = <-in:
+			case <-ctx.Done():
+				go Drain(in)
+				return
+			}
+			for {
+				if !ok {
+					return
+				}
+				select {
+				case latest, ok = <-in:
+					continue // newer update
+
+				case out <- latest:
+					break // update delivered
+
+				case <-ctx.Done():
+					go Drain(in)
+					return
+				}
+				break
+			}
+		}
+	}()
+
+	return in, out
+}
+
+// FeedMode is a coalescing strategy.
+type FeedMode int
+
+// Coalescing strategies.
+const (
+	LastWins FeedMode = iota // pending values are replaced
+	Merging                  // pending values are combined
+)
+
+// String returns the name of m.
+func (m FeedMode) String() string {
+	switch m {
+	case LastWins:
+		return "last-wins"
+	case Merging:
+		return "merging"
+	default:
+		return "unknown"
+	}
+}
+
+// AdaptiveFeed is a Feed which switches its coalescing under load.
+type AdaptiveFeed struct {
+	Feed
+	mode int32 // FeedMode; atomic access only
+}
+
+// NewAdaptiveFeed is like NewFeed, yet it switches to merge, as with
+// NewMergeFeed, once threshold values got replaced between two deliveries.
+// The feed reverts to last-wins once a delivery happened without any value
+// replaced or merged in the mean time, i.e., when the receiver caught up.
+func NewAdaptiveFeed(notify chan<- interface{}, merge func(acc, next interface{}) interface{}, threshold int) *AdaptiveFeed {
+	feed := make(chan interface{})
+	f := new(AdaptiveFeed)
+	f.Feed = feed
+
+	go func() {
+		for {
+			// await update
+			acc, ok := <-feed
+			var coalesced int // since delivery
+			for {
+				if !ok {
+					return
+				}
+				var next interface{}
+				select {
+				case next, ok = <-feed:
+					if !ok {
+						continue
+					}
+					coalesced++
+					if f.Mode() == Merging {
+						acc = merge(acc, next)
+						continue
+					}
+					acc = next
+					if coalesced >= threshold {
+						atomic.StoreInt32(&f.mode, int32(Merging))
+					}
+					continue
+
+				case notify <- acc:
+					if coalesced == 0 {
+						atomic.StoreInt32(&f.mode, int32(LastWins))
+					}
+				}
+				break
+			}
+		}
+	}()
+
+	return f
+}
+
+// Mode returns the coalescing strategy in effect.
+func (f *AdaptiveFeed) Mode() FeedMode {
+	return FeedMode(atomic.LoadInt32(&f.mode))
+}
+
+// dropBuffer is the capacity for NewFeedOnDrop hook invocations pending.
+const dropBuffer = 16
+
+// NewFeedOnDrop is like NewFeed, yet onDrop receives each value which was
+// replaced before delivery. The hook runs on a routine of its own, such that
+// it can't stall delivery. Invocations are skipped when the hook falls behind
+// by more than a few values, i.e., auditing is best-effort.
+func NewFeedOnDrop(notify chan<- interface{}, onDrop func(dropped interface{})) Feed {
+	feed := make(chan interface{})
+	drops := make(chan interface{}, dropBuffer)
+
+	go func() {
+		for v := range drops {
+			onDrop(v)
+		}
+	}()
+
+	go func() {
+		defer close(drops)
+		for {
+			// await update
+			latest, ok := <-feed
+			for {
+				if !ok {
+					return
+				}
+				var next interface{}
+				select {
+				case next, ok = <-feed:
+					if ok {
+						select {
+						case drops <- latest:
+						default:
+							break // hook behind
+						}
+						latest = next
+					}
+					continue // newer update
+
+				case notify <- latest:
+					break // update delivered
+				}
+				break
+			}
+		}
+	}()
+
+	return feed
+}
+
+// NewThresholdFeed is like NewFeed, yet values which differ less than minDelta
+// from the last delivery, according to toFloat, are discarded. Any value
+// pending is discarded too in such case, as the receiver has an equivalent
+// already. The first value is always delivered. Values for which toFloat
+// returns NaN, i.e., values which don't convert, pass without comparison, and
+// the value after is delivered regardless too.
+func NewThresholdFeed(notify chan<- interface{}, minDelta float64, toFloat func(interface{}) float64) Feed {
+	feed := make(chan interface{})
+
+	go func() {
+		var out chan<- interface{} // nil blocks
+		var latest interface{}     // pending value
+		var x float64              // toFloat(latest)
+		var base float64           // toFloat of last delivery
+		var hasBase bool           // whether base applies
+		for {
+			select {
+			case v, ok := <-feed:
+				if !ok {
+					return
+				}
+				f := toFloat(v)
+				if hasBase && !math.IsNaN(f) && math.Abs(f-base) < minDelta {
+					out, latest = nil, nil // equivalent delivered
+					continue
+				}
+				out, latest, x = notify, v, f
+
+			case out <- latest:
+				base, hasBase = x, !math.IsNaN(x)
+				out, latest = nil, nil
+			}
+		}
+	}()
+
+	return feed
+}
+
+// NewWindowFeed is like NewFeed, yet values coalesce during a window which
+// starts on the first value after each delivery. The latest value is delivered
+// when the window ends, which caps the rate to one value per window, regardless
+// of the receiver speed. Windows run on clock, with nil for the SystemClock.
+func NewWindowFeed(notify chan<- interface{}, window time.Duration, clock Clock) Feed {
+	feed := make(chan interface{})
+	clock = clockOrSystem(clock)
+
+	go func() {
+		var latest interface{}     // pending value
+		var pending bool           // whether latest is undelivered
+		var end <-chan time.Time   // window in progress
+		var out chan<- interface{} // nil blocks
+		for {
+			select {
+			case v, ok := <-feed:
+				if !ok {
+					return
+				}
+				latest = v
+				if !pending {
+					pending = true
+					end = clock.After(window)
+				}
+
+			case <-end:
+				end = nil
+				out = notify
+
+			case out <- latest:
+				out, latest = nil, nil
+				pending = false
+			}
+		}
+	}()
+
+	return feed
+}
+
+// NewDistinctWindowFeed is like NewWindowFeed, yet the latest value of each
+// window is discarded when eq reports it equal to the last delivery. Noisy
+// producers get both their duplicates and their cadence suppressed thus. The
+// first value is always delivered, after its window. Windows run on clock,
+// with nil for the SystemClock.
+func NewDistinctWindowFeed(notify chan<- interface{}, window time.Duration, eq func(a, b interface{}) bool, clock Clock) Feed {
+	feed := make(chan interface{})
+	clock = clockOrSystem(clock)
+
+	go func() {
+		var latest interface{}     // pending value
+		var pending bool           // whether latest is undelivered
+		var last interface{}       // last delivery
+		var hasLast bool           // whether last applies
+		var end <-chan time.Time   // window in progress
+		var out chan<- interface{} // nil blocks
+		for {
+			select {
+			case v, ok := <-feed:
+				if !ok {
+					return
+				}
+				latest = v
+				if !pending {
+					pending = true
+					end = clock.After(window)
+				}
+
+			case <-end:
+				end = nil
+				if hasLast && eq(last, latest) {
+					latest, pending = nil, false // receiver has it
+					continue
+				}
+				out = notify
+
+			case out <- latest:
+				last, hasLast = latest, true
+				out, latest = nil, nil
+				pending = false
+			}
+		}
+	}()
+
+	return feed
+}
+
+// Fork delivers each value from in to two new channels, with coalescing per
+// output, as with NewFeed, such that each receiver goes at its own pace. Both
+// outputs are closed once in is closed. Any value pending at that moment is
+// discarded. Each value is handed to the routine of out1 before the one of
+// out2, such that a receive from out2 implies that out1 has the value too.
+func Fork(in <-chan interface{}) (out1, out2 <-chan interface{}) {
+	c1, c2 := make(chan interface{}), make(chan interface{})
+	feed1, feed2 := make(chan interface{}), make(chan interface{})
+	go func() {
+		defer close(c1)
+		forward(feed1, c1)
+	}()
+	go func() {
+		defer close(c2)
+		forward(feed2, c2)
+	}()
+
+	go func() {
+		defer close(feed1)
+		defer close(feed2)
+		for v := range in {
+			feed1 <- v
+			feed2 <- v
+		}
+	}()
+
+	return c1, c2
+}
+
+// NewWarmupFeed is like NewFeed, yet the first n submissions are discarded,
+// e.g., to skip any defaults during startup. Closure of the input channel
+// during warmup terminates the routine without any delivery.
+func NewWarmupFeed(notify chan<- interface{}, n int) Feed {
+	feed := make(chan interface{})
+
+	go func() {
+		for i := 0; i < n; i++ {
+			if _, ok := <-feed; !ok {
+				return
+			}
+		}
+		forward(feed, notify)
+	}()
+
+	return feed
+}
+
+// closedSentinel is the type of Closed.
+type closedSentinel struct{}
+
+// String returns the name of the sentinel.
+func (closedSentinel) String() string { return "latest.Closed" }
+
+// Closed is the final value from a NewFeedSentinel, as in v == latest.Closed.
+// No other source produces the value.
+var Closed interface{} = closedSentinel{}
+
+// NewFeedSentinel is like NewFeed, yet the routine delivers Closed once the
+// input channel is closed. Any value pending at that moment is discarded. The
+// sentinel distinguishes the end of a feed from a nil value, as notify itself
+// remains open. Receivers which own the notify channel may prefer to close it
+// instead, and check the ok bool of the receive. Note that the routine blocks
+// until the sentinel is received.
+func NewFeedSentinel(notify chan<- interface{}) Feed {
+	feed := make(chan interface{})
+	go func() {
+		forward(feed, notify)
+		notify <- Closed
+	}()
+	return feed
+}
+
+// Drain receives and discards until notify is closed. Shutdown code may use
+// Drain to unblock any routine which still sends to notify.
+func Drain(notify <-chan interface{}) {
+	for range notify {
+		// discard
+	}
+}
+
+// Recv receives one value from notify, and it returns the value as a T. The
+// return is the zero value and false when notify is closed, or when the value
+// is not a T, including nil, in which case the value is discarded.
+func Recv[T any](notify <-chan interface{}) (T, bool) {
+	v, ok := <-notify
+	t, isT := v.(T)
+	return t, ok && isT
+}
@@ -0,0 +1,93 @@
+package latest
+
+import (
+	"context"
+	"sync"
+)
+
+// FlagBroadcast is a Broadcast of a boolean state, such as healthy or leader.
+// The zero value is ready to use, with the flag off.
+type FlagBroadcast struct {
+	b Broadcast
+
+	mutex sync.Mutex
+	subs  map[chan<- bool]func() // cancel per subscription
+}
+
+// Set updates the flag. The error is ErrClosed after Close.
+func (f *FlagBroadcast) Set(on bool) error {
+	return f.b.Update(on)
+}
+
+// Get returns the current state.
+func (f *FlagBroadcast) Get() bool {
+	v, _ := f.b.Load()
+	on, _ := v.(bool)
+	return on
+}
+
+// Subscribe adds an update receiver. Slow receivers get the latest state only,
+// as with Broadcast. Duplicate subscriptions are ignored. The error is
+// ErrClosed after Close.
+func (f *FlagBroadcast) Subscribe(notify chan<- bool) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.subs[notify]; ok {
+		return nil
+	}
+	stop := make(chan struct{})
+	cancel, err := f.b.SubscribeFunc(func(v interface{}) {
+		select {
+		case notify <- v.(bool):
+		case <-stop:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if f.subs == nil {
+		f.subs = make(map[chan<- bool]func())
+	}
+	f.subs[notify] = func() {
+		cancel()
+		close(stop)
+	}
+	return nil
+}
+
+// Unsubscribe terminates a subscription.
+func (f *FlagBroadcast) Unsubscribe(notify chan<- bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if cancel, ok := f.subs[notify]; ok {
+		delete(f.subs, notify)
+		cancel()
+	}
+}
+
+// Wait blocks until the flag is in the want state. The error is ErrClosed on
+// Close, or from ctx.
+func (f *FlagBroadcast) Wait(ctx context.Context, want bool) error {
+	if _, ok := f.b.Load(); !ok && !want {
+		return nil // off without Set
+	}
+	_, err := f.b.WaitFor(ctx, func(v interface{}) bool {
+		return v.(bool) == want
+	})
+	return err
+}
+
+// Close terminates all subscriptions, and it makes any further Set or
+// Subscribe fail with ErrClosed.
+func (f *FlagBroadcast) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for notify, cancel := range f.subs {
+		delete(f.subs, notify)
+		cancel()
+	}
+	f.b.Close()
+}
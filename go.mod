@@ -1,3 +1,3 @@
 module github.com/pascaldekloe/latest
 
-go 1.10
+go 1.18
@@ -0,0 +1,75 @@
+package latest
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TextHandler returns an HTTP handler which responds with the current version
+// of b as plain text. Values render with their String method, if any, or else
+// with their MarshalText method, if any, or else with fmt.Sprint. The ETag is
+// the sequence number, as by Seq, and a matching If-None-Match gets 304 (Not
+// Modified), such that clients can poll cheaply. Sequence numbers start over
+// with each Broadcast, e.g., after a restart, and so do the ETags. The status
+// code is 404 (Not Found) while no Update happened yet. Methods other than GET
+// and HEAD get 405 (Method Not Allowed).
+func (b *Broadcast) TextHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		v, seq, _, ok := b.State()
+		if !ok {
+			http.Error(w, "no current version", http.StatusNotFound)
+			return
+		}
+		etag := `"` + strconv.FormatUint(seq, 10) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		text, err := renderText(v)
+		if err != nil {
+			http.Error(w, "current version does not render", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(text)))
+		if r.Method != http.MethodHead {
+			w.Write(text)
+		}
+	})
+}
+
+// etagMatch returns whether the If-None-Match header value covers etag.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		tag = strings.TrimPrefix(tag, "W/") // weak comparison
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// renderText formats v for TextHandler.
+func renderText(v interface{}) ([]byte, error) {
+	switch t := v.(type) {
+	case fmt.Stringer:
+		return []byte(t.String()), nil
+	case encoding.TextMarshaler:
+		return t.MarshalText()
+	default:
+		return []byte(fmt.Sprint(v)), nil
+	}
+}
@@ -1,7 +1,34 @@
 // Package latest provides ways to keep track of a current version.
 package latest
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Feeder is the minimal method set of a feed. Code which depends on a feed
+// can accept a Feeder, such that tests may inject a deterministic double.
+type Feeder interface {
+	// Send submits an update.
+	Send(v interface{})
+	// Close terminates the feed.
+	Close()
+}
+
+// Feed is the input channel of a feed routine. The channel type keeps send
+// and close statements working.
+type Feed chan<- interface{}
+
+// Send submits v, like a send statement does.
+func (f Feed) Send(v interface{}) { f <- v }
+
+// Close terminates the routine, like a close statement does.
+func (f Feed) Close() { close(f) }
 
 // NewFeed returns a non-blocking input channel for notify.
 // The notification process uses the latest input only. Any
@@ -9,69 +36,1054 @@ import "sync"
 // Processing terminates when the input channel is closed.
 // Be careful with buffered channels as they interfear with
 // data freshness.
-func NewFeed(notify chan<- interface{}) chan<- interface{} {
+func NewFeed(notify chan<- interface{}) Feed {
+	feed := make(chan interface{})
+	go forward(feed, notify)
+	return feed
+}
+
+// NewSyncFeed returns a Feed for tests, which passes each value to notify in
+// the send itself, without any routine nor coalescing. A send on an unbuffered
+// notify returns once the receiver has the value, such that assertions don't
+// race with delivery. Note that slow receivers block the sender, and that Close
+// closes notify, unlike NewFeed.
+func NewSyncFeed(notify chan<- interface{}) Feed {
+	return Feed(notify)
+}
+
+// NewLabeledFeed is like NewFeed, yet the routine runs with labels, which
+// attribute its work in goroutine dumps and CPU profiles. See pprof.Do for
+// details.
+func NewLabeledFeed(notify chan<- interface{}, labels pprof.LabelSet) Feed {
 	feed := make(chan interface{})
+	go pprof.Do(context.Background(), labels, func(context.Context) {
+		forward(feed, notify)
+	})
+	return feed
+}
+
+// NewFeedErrs is like NewFeed, with an error channel for diagnostics. The
+// routine recovers from a panic, such as a send on a closed notify channel,
+// in which case errs receives the cause. Any input after a panic is
+// discarded. Errs is closed once the routine exits.
+func NewFeedErrs(notify chan<- interface{}) (feed Feed, errs <-chan error) {
+	in := make(chan interface{})
+	c := make(chan error, 1)
 
 	go func() {
+		defer close(c)
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			c <- fmt.Errorf("latest: feed routine panic: %v", r)
+			for range in {
+				// discard until closed
+			}
+		}()
+
+		forward(in, notify)
+	}()
+
+	return in, c
+}
+
+// forward implements the NewFeed routine.
+func forward(feed <-chan interface{}, notify chan<- interface{}) {
+	for {
+		// await update
+		latest, ok := <-feed
 		for {
-			// await update
-			latest, ok := <-feed
-			for {
-				if !ok {
-					return
-				}
-				select {
-				case latest, ok = <-feed:
-					continue // newer update
+			if !ok {
+				return
+			}
+			select {
+			case latest, ok = <-feed:
+				continue // newer update
 
-				case notify <- latest:
-					break // update delivered
-				}
-				break
+			case notify <- latest:
+				break // update delivered
 			}
+			break
 		}
-	}()
-
-	return feed
+	}
 }
 
+// ErrClosed signals use of a Broadcast after Close.
+var ErrClosed = errors.New("latest: broadcast closed")
+
 // Broadcast enqueues the latest Update (publication) for each subscriber
 // individually. Slow subscribers do not block Update submission. Instead,
 // any pending [undelivered] publications are replaced with the latest.
 // Multiple goroutines may invoke methods on a Broadcast simultaneously.
 type Broadcast struct {
 	sync.RWMutex // subscription lock
-	feeds        map[chan<- interface{}]chan<- interface{}
+	feeds        map[chan<- interface{}]*subscription
+	peak         int   // maximum subscription count since allocation
+	count        int32 // len(feeds) for lock-free reads; atomic access
+
+	order  []*subscription            // fan-out sequence, by priority
+	groups map[string][]*subscription // SubscribeGroup index, by priority
+	rotate uint                       // fan-out counter for ties
+
+	latest    interface{} // current version
+	hasLatest bool        // whether latest is set
+	seq       uint64      // number of versions set
+	at        time.Time   // moment of latest set
+
+	joins uint64 // number of subscriptions made, for order of age
+
+	closed bool // Close in effect
+	paused bool // Pause in effect
+	held   bool // Update withheld on pause
+
+	flushing chan struct{} // closed once CloseAndFlush terminated all, if any
+
+	// SendTimeout limits the time Update waits on each subscription, with
+	// zero for no limit. Feed routines are always ready to receive, so the
+	// timeout only triggers when the scheduler fails to run them in time,
+	// e.g., on severe CPU starvation. Subscriptions skipped on timeout miss
+	// the respective update, as counted by Stats.
+	SendTimeout time.Duration
+
+	// DeliveryJitter delays each delivery by a random duration in the range
+	// of [0, DeliveryJitter). Wakeups of many subscribers get spread, which
+	// smooths load spikes on any shared resources downstream. Values remain
+	// subject to coalescing during the delay. Zero and negative values
+	// disable jitter. Subscriptions made before a change are not affected.
+	DeliveryJitter time.Duration
+
+	// MaxAge, when positive, discards values which are not delivered within
+	// the duration since their Update. Slow receivers get nothing rather than
+	// stale data in such case. Subscriptions made before a change are not
+	// affected.
+	MaxAge time.Duration
+
+	// Clone, when set, copies each value for each subscription individually.
+	// Without Clone, all subscribers receive the same value, which means that
+	// mutation of a pointer, slice or map value affects the others. Clone
+	// runs in the feed routines. Subscriptions made before a change are not
+	// affected. See SubscribeCopy for isolation of individual subscribers.
+	Clone func(interface{}) interface{}
+
+	// Workers, when set, is the number of routines which run SubscribeFunc
+	// callbacks. Each callback gets a routine of its own otherwise. Changes
+	// after the first SubscribeFunc have no effect.
+	Workers int
+
+	// History is the number of recent versions to retain, with zero for
+	// none. See HistorySnapshot.
+	History int
+
+	// Validate, when set, guards Update. Values with a non-nil error are
+	// rejected, without any effect on the current version.
+	Validate func(interface{}) error
+
+	// IdleTimeout, when positive, ends the feed routine of a subscription
+	// after the duration without any input. The routine restarts on the next
+	// update, which trades a little latency on wakeup for fewer routines in
+	// idle. Callbacks from SubscribeFunc are not affected. Subscriptions made
+	// before a change are not affected.
+	IdleTimeout time.Duration
+
+	// OverloadThreshold is the number of values in a row discarded on
+	// coalescing for a subscription to count as overloaded, with zero for 8.
+	// See Overloaded. Subscriptions made before a change are not affected.
+	OverloadThreshold int
+
+	// Logger, when set, receives lifecycle events and degradation, such as
+	// skipped sends and recovered panics.
+	Logger Logger
+
+	// MaxSubscribers limits the number of subscriptions, with zero for no
+	// limit. LimitPolicy determines what happens to subscriptions beyond.
+	// Subscriptions in place are not affected by a change.
+	MaxSubscribers int
+
+	// LimitPolicy applies when the MaxSubscribers count is reached. The
+	// zero value rejects new subscriptions. EvictOldest terminates the
+	// subscription which was made first instead, for live views where the
+	// newest receivers matter most.
+	LimitPolicy LimitPolicy
+
+	// OnEvict, when set, receives the notify channel of each subscription
+	// terminated by EvictOldest, as the reason of termination. Callbacks from
+	// SubscribeFunc have an internal channel, for identity only. OnEvict runs
+	// on a routine of its own, once the feed routine stopped, such that the
+	// channel can be closed safely.
+	OnEvict func(notify chan<- interface{})
+
+	// Go, when set, starts the feed routines of subscriptions, including
+	// the routines for SubscribeFunc, instead of a go statement. Auxiliary
+	// routines, such as the ctx watch of SubscribeContext, the OnEvict calls
+	// and the CountChanges routine, start with Go too. Runtimes may use Go to
+	// recover from panics, or to apply labels uniformly. Go must start f
+	// promptly, without queueing, as feed routines live as long as their
+	// subscription, and as the fan-out awaits each routine under the lock.
+	// Use Workers to cap the number of routines for SubscribeFunc instead.
+	// Subscriptions made before a change are not affected, and neither is
+	// the Workers pool once started. Standalone feeds, such as NewFeed, have
+	// no Broadcast, and they always start with a go statement.
+	Go func(f func())
+
+	// Clock, when set, replaces the system time for update timestamps, for
+	// DeliveryJitter and for MaxAge. SendTimeout always runs on system time.
+	// Subscriptions made before a change are not affected.
+	Clock Clock
+
+	hist     []version // ring buffer for History
+	histNext int       // ring buffer position
+
+	timeouts uint64 // number of sends skipped on SendTimeout
+	dropped  uint64 // number of values discarded by past subscriptions
+
+	countNotify chan int   // CountChanges output, if any
+	countFeed   chan<- int // CountChanges input, if any
+
+	pool *pool      // Workers, if any
+	cond *sync.Cond // Wait, if any
+
+	onClose []func() // Close hooks
+
+	events   eventLog       // Events, if any
+	overload overloadSignal // Overloaded, if any
+	caughtUp idleSignal     // WaitIdle, if any
+
+	computing chan struct{} // closed on LoadOrCompute completion, if any
+}
+
+// Stats holds Broadcast counters.
+type Stats struct {
+	Timeouts uint64 // number of sends skipped on SendTimeout
+	Drops    uint64 // number of values discarded, e.g., on coalescing
+}
+
+// Update sets the current version. Subscriptions are served one by one, in
+// order of priority. Ties rotate, such that no subscriber is consistently
+// served last. The error is either from Validate, or ErrClosed after Close,
+// or nil.
+func (b *Broadcast) Update(v interface{}) error {
+	if b.Validate != nil {
+		if err := b.Validate(v); err != nil {
+			return err
+		}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	fanOut, err := b.set(v)
+	if fanOut {
+		b.each(func(s *subscription) {
+			b.send(s, message{v: v, at: b.at})
+		})
+	}
+	return err
+}
+
+// Swap is like Update, and it returns the version replaced in the same atomic
+// step. HadPrev is false when no Update happened before. Values rejected by
+// Validate, and values after Close, are not set, in which case the return is
+// the current version still.
+func (b *Broadcast) Swap(v interface{}) (prev interface{}, hadPrev bool) {
+	if b.Validate != nil && b.Validate(v) != nil {
+		return b.Load()
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	prev, hadPrev = b.latest, b.hasLatest
+	fanOut, _ := b.set(v)
+	if fanOut {
+		b.each(func(s *subscription) {
+			b.send(s, message{v: v, at: b.at})
+		})
+	}
+	return prev, hadPrev
+}
+
+// CompareAndUpdate is like Update, yet new is set only when the current version
+// equals old according to eq, with == for a nil eq. Without any Update yet, a
+// nil old matches, and any other old does not. The return is whether new was
+// set. Values rejected by Validate, and values after Close, are not set.
+func (b *Broadcast) CompareAndUpdate(old, new interface{}, eq func(a, b interface{}) bool) bool {
+	if eq == nil {
+		eq = equalComparable
+	}
+	if b.Validate != nil && b.Validate(new) != nil {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.hasLatest {
+		if !eq(b.latest, old) {
+			return false
+		}
+	} else if old != nil {
+		return false
+	}
+	fanOut, err := b.set(new)
+	if err != nil {
+		return false
+	}
+	if fanOut {
+		b.each(func(s *subscription) {
+			b.send(s, message{v: new, at: b.at})
+		})
+	}
+	return true
+}
+
+// Batch applies the final value set by f, if any, with one Update once f
+// returns. Intermediate values are never fanned out. Concurrent Updates from
+// other routines are not included in the batch; they go out as usual, and
+// the final value of the batch overrides them. The error is from Update.
+func (b *Broadcast) Batch(f func(set func(interface{}))) error {
+	var final interface{}
+	var ok bool
+	f(func(v interface{}) {
+		final, ok = v, true
+	})
+	if !ok {
+		return nil
+	}
+	return b.Update(final)
+}
+
+// UpdateTracked is like Update, and it returns each notify channel which got
+// v delivered without delay, i.e., without any coalescing.
+func (b *Broadcast) UpdateTracked(v interface{}) (delivered []chan<- interface{}, err error) {
+	if b.Validate != nil {
+		if err := b.Validate(v); err != nil {
+			return nil, err
+		}
+	}
+
+	type tracked struct {
+		notify chan<- interface{}
+		ack    <-chan bool
+	}
+	var acks []tracked
+
+	b.Lock()
+	fanOut, err := b.set(v)
+	if fanOut {
+		acks = make([]tracked, 0, len(b.order))
+		b.each(func(s *subscription) {
+			ack := make(chan bool, 1)
+			if b.send(s, message{v: v, at: b.at, ack: ack}) {
+				acks = append(acks, tracked{s.notify, ack})
+			}
+		})
+	}
+	b.Unlock()
+
+	// await delivery attempts without lock
+	for _, t := range acks {
+		if <-t.ack {
+			delivered = append(delivered, t.notify)
+		}
+	}
+	return delivered, err
+}
+
+// UpdateWait is like Update, yet it awaits the subscriptions to deliver v, as
+// opposed to coalescing or discarding v otherwise, for up to timeout. All
+// subscriptions get the same window, as they are awaited in parallel, without
+// any lock held. The return is the number of subscriptions which delivered v.
+func (b *Broadcast) UpdateWait(v interface{}, timeout time.Duration) (confirmed int, err error) {
+	return b.updateConfirmed(v, -1, timeout)
+}
+
+// ErrFull signals a subscription refused on MaxSubscribers.
+var ErrFull = errors.New("latest: subscriber limit reached")
+
+// LimitPolicy is the behaviour on MaxSubscribers.
+type LimitPolicy int
+
+// Subscriber limit policies.
+const (
+	RejectNew   LimitPolicy = iota // new subscriptions fail with ErrFull
+	EvictOldest                    // the oldest subscription makes room
+)
+
+// ErrQuorum signals an UpdateQuorum with too few deliveries.
+var ErrQuorum = errors.New("latest: quorum not reached")
+
+// UpdateQuorum is like UpdateWait, yet it returns as soon as n subscriptions
+// delivered v. The error is ErrQuorum when less than n subscriptions delivered
+// v within timeout.
+func (b *Broadcast) UpdateQuorum(v interface{}, n int, timeout time.Duration) (acked int, err error) {
+	acked, err = b.updateConfirmed(v, n, timeout)
+	if err == nil && acked < n {
+		err = ErrQuorum
+	}
+	return acked, err
+}
+
+// updateConfirmed implements UpdateWait, with a negative n for all, and
+// UpdateQuorum.
+func (b *Broadcast) updateConfirmed(v interface{}, n int, timeout time.Duration) (confirmed int, err error) {
+	if b.Validate != nil {
+		if err := b.Validate(v); err != nil {
+			return 0, err
+		}
+	}
+
+	var confirm chan bool
+	var pending int
+
+	b.Lock()
+	fanOut, err := b.set(v)
+	if fanOut {
+		confirm = make(chan bool, len(b.order))
+		b.each(func(s *subscription) {
+			if b.send(s, message{v: v, at: b.at, confirm: confirm}) {
+				pending++
+			}
+		})
+	}
+	b.Unlock()
+
+	if pending == 0 || n == 0 {
+		return 0, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for ; pending > 0; pending-- {
+		select {
+		case ok := <-confirm:
+			if ok {
+				confirmed++
+				if confirmed == n {
+					return confirmed, err
+				}
+			}
+		case <-timer.C:
+			return confirmed, err
+		}
+	}
+	return confirmed, err
+}
+
+// set makes v the current version. The fan-out must follow when so. The
+// error is ErrClosed after Close. The caller must hold the write lock.
+func (b *Broadcast) set(v interface{}) (fanOut bool, err error) {
+	if b.closed {
+		return false, ErrClosed
+	}
+
+	b.latest, b.hasLatest = v, true
+	b.seq++
+	b.at = clockOrSystem(b.Clock).Now()
+	b.retain()
+	if b.cond != nil {
+		b.cond.Broadcast()
+	}
+	if b.paused {
+		b.held = true
+		return false, nil
+	}
+	return true, nil
+}
+
+// version is a retained value.
+type version struct {
+	v   interface{}
+	seq uint64
+	at  time.Time
+}
+
+// retain adds the current version to the History, if any.
+// The caller must hold the write lock.
+func (b *Broadcast) retain() {
+	if b.History <= 0 {
+		return
+	}
+	entry := version{b.latest, b.seq, b.at}
+	if len(b.hist) < b.History {
+		b.hist = append(b.hist, entry)
+		return
+	}
+	b.histNext %= len(b.hist)
+	b.hist[b.histNext] = entry
+	b.histNext++
+}
+
+// history returns the retained versions, from old to new.
+// The caller must hold a read lock.
+func (b *Broadcast) history() []version {
+	if len(b.hist) == 0 {
+		return nil
+	}
+	i := b.histNext % len(b.hist)
+	return append(append(make([]version, 0, len(b.hist)), b.hist[i:]...), b.hist[:i]...)
 }
 
-// Update sets the current version.
-func (b *Broadcast) Update(v interface{}) {
+// HistorySnapshot returns a copy of the retained versions, from old to new,
+// as configured with History.
+func (b *Broadcast) HistorySnapshot() []interface{} {
 	b.RLock()
 	defer b.RUnlock()
 
-	for _, feed := range b.feeds {
-		feed <- v
+	hist := b.history()
+	values := make([]interface{}, len(hist))
+	for i := range hist {
+		values[i] = hist[i].v
+	}
+	return values
+}
+
+// Pause suspends the fan-out of updates without affecting subscriptions.
+// Update still sets the current version in the meantime.
+func (b *Broadcast) Pause() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.paused = true
+}
+
+// Resume ends a Pause. The current version is delivered once to each
+// subscription when any updates were withheld.
+func (b *Broadcast) Resume() {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.paused {
+		return
+	}
+	b.paused = false
+	if b.held {
+		b.held = false
+		b.each(func(s *subscription) {
+			if s.seen == b.seq {
+				return // SubscribeLatest had it
+			}
+			b.send(s, message{v: b.latest, at: b.at})
+		})
+		b.caughtUp.emit() // in case of no subscriptions
+	}
+}
+
+// each invokes f for all subscriptions, in fan-out order.
+// The caller must hold the write lock.
+func (b *Broadcast) each(f func(*subscription)) {
+	b.eachOf(b.order, f)
+}
+
+// eachOf invokes f for each subscription in list, which is in order of
+// priority. The caller must hold the write lock.
+func (b *Broadcast) eachOf(list []*subscription, f func(*subscription)) {
+	b.rotate++
+	for i := 0; i < len(list); {
+		// range of equal priority
+		end := i + 1
+		for end < len(list) && list[end].priority == list[i].priority {
+			end++
+		}
+
+		n := end - i
+		offset := int(b.rotate % uint(n))
+		for j := 0; j < n; j++ {
+			f(list[i+(offset+j)%n])
+		}
+		i = end
+	}
+}
+
+// send passes m to s, with respect to SendTimeout. The return is false on
+// timeout, or when s is muted. The caller must hold the write lock.
+func (b *Broadcast) send(s *subscription, m message) (passed bool) {
+	if s.muted {
+		return false
+	}
+	if s.cb != nil {
+		s.cb.deliver(m)
+		return true
+	}
+	if s.idle > 0 {
+		s.wake()
+		defer s.sent()
+	}
+	if b.SendTimeout <= 0 {
+		s.feed <- m
+		atomic.AddUint64(&s.queued, 1)
+		return true
+	}
+
+	timer := time.NewTimer(b.SendTimeout)
+	defer timer.Stop()
+	select {
+	case s.feed <- m:
+		atomic.AddUint64(&s.queued, 1)
+		return true
+	case <-timer.C:
+		b.timeouts++
+		b.log().Warnf("latest: send skipped after timeout of %s", b.SendTimeout)
+		return false
 	}
 }
 
 // Subscribe adds an update receiver.
 // Duplicate subscriptions are ignored.
-func (b *Broadcast) Subscribe(notify chan<- interface{}) {
-	feed := NewFeed(notify)
+// The error is ErrClosed after Close, and nil otherwise.
+func (b *Broadcast) Subscribe(notify chan<- interface{}) error {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if s != nil {
+		s.spawn(s.run)
+	}
+	return err
+}
+
+// SubscribeDistinct is like Subscribe, yet values equal to the last one
+// delivered to notify are suppressed. Equality applies per subscription, across
+// any coalescing, with == for a nil eq. Values which are not comparable with
+// == never match.
+func (b *Broadcast) SubscribeDistinct(notify chan<- interface{}, eq func(a, b interface{}) bool) error {
+	if eq == nil {
+		eq = equalComparable
+	}
 
 	b.Lock()
 	defer b.Unlock()
 
-	if _, ok := b.feeds[notify]; ok {
-		// already subscribed
-		close(feed)
+	s, err := b.subscribe(notify, 0)
+	if s != nil {
+		s.equal = eq
+		s.spawn(s.run)
+	}
+	return err
+}
+
+// SubscribeCopy is like Subscribe, yet notify receives a copy of each value,
+// from clone, such that mutation by the receiver can't affect others, nor the
+// current version. Clone replaces Broadcast.Clone for this subscription. Only
+// the subscriptions which need isolation pay for the copies thus. All other
+// subscriptions (without Clone) share the value with each other, and with the
+// Update caller, so they must treat pointer, slice and map values read-only.
+func (b *Broadcast) SubscribeCopy(notify chan<- interface{}, clone func(interface{}) interface{}) error {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if s != nil {
+		s.clone = clone
+		s.spawn(s.run)
+	}
+	return err
+}
+
+// equalComparable is == with a guard for types which are not comparable.
+func equalComparable(a, b interface{}) (equal bool) {
+	defer func() {
+		if recover() != nil {
+			equal = false
+		}
+	}()
+	return a == b
+}
+
+// SubscribeRetry is like Subscribe, yet an undelivered value gets up to retries
+// more attempts when a newer one arrives, with a backoff per attempt, before it
+// is replaced. The newer value is held back in the mean time, with coalescing
+// of any updates thereafter, so Update never waits on the retries. Borderline-
+// slow receivers get a better chance to see each value in return for a bounded
+// delay of the newer value, i.e., retries times backoff at most. Zero retries
+// is equivalent to Subscribe.
+func (b *Broadcast) SubscribeRetry(notify chan<- interface{}, retries int, backoff time.Duration) error {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if s != nil {
+		s.retries, s.backoff = retries, backoff
+		s.spawn(s.run)
+	}
+	return err
+}
+
+// SubscribeFromSeq is like Subscribe, yet the versions after sinceSeq, as
+// numbered by Seq, are delivered first, one by one, in order of appearance.
+// Replay comes from the versions retained with History, plus the current
+// version. Updates during the replay coalesce, as usual, until the replay is
+// done. Gap is true when versions after sinceSeq are no longer retained, in
+// which case the replay starts at the oldest version available. Duplicate
+// subscriptions are ignored. The error is ErrClosed after Close.
+func (b *Broadcast) SubscribeFromSeq(notify chan<- interface{}, sinceSeq uint64) (gap bool, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if s == nil {
+		return false, err
+	}
+	if b.seq > sinceSeq {
+		var firstSeq uint64
+		for _, e := range b.history() {
+			if e.seq > sinceSeq {
+				if firstSeq == 0 {
+					firstSeq = e.seq
+				}
+				s.replay = append(s.replay, e.v)
+			}
+		}
+		if firstSeq == 0 {
+			// current version not retained
+			firstSeq = b.seq
+			s.replay = append(s.replay, b.latest)
+		}
+		gap = firstSeq > sinceSeq+1
+	}
+	s.spawn(s.run)
+	return gap, nil
+}
+
+// SubscribeContext is like Subscribe, yet the subscription terminates once ctx
+// is done. A ctx which is done already registers nothing, with ctx.Err() as the
+// error. Otherwise, the error is ErrClosed after Close, and nil on success.
+func (b *Broadcast) SubscribeContext(ctx context.Context, notify chan<- interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if s != nil {
+		s.spawn(s.run)
+		s.spawn(func() {
+			select {
+			case <-ctx.Done():
+				b.Lock()
+				// only when not replaced in the mean time
+				if b.feeds[notify] == s {
+					b.unsubscribe(notify)
+				}
+				b.Unlock()
+			case <-s.done:
+				break // unsubscribed otherwise
+			}
+		})
+	}
+	return err
+}
+
+// SubscribePriority is like Subscribe, yet the fan-out of each update is in
+// order of priority, from high to low. Subscribe has priority zero. Note that
+// the order applies to the hand-over to feed routines, which deliver
+// asynchronously. A receiver which is ready gets updates before receivers of
+// lower priority, yet the processing of updates is not awaited.
+func (b *Broadcast) SubscribePriority(notify chan<- interface{}, priority int) error {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, priority)
+	if s != nil {
+		s.spawn(s.run)
+	}
+	return err
+}
+
+// SubscribeConfirmed is like Subscribe, and it returns a channel which is
+// closed once the feed routine runs. Note that updates are never lost after
+// Subscribe returns, even when the routine did not start yet, because an
+// Update awaits the routine to receive. Ready serves as a synchronisation
+// point nonetheless. Duplicates get a ready channel which is closed already.
+func (b *Broadcast) SubscribeConfirmed(notify chan<- interface{}) (ready <-chan struct{}, err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan struct{})
+	if s == nil {
+		close(c) // already subscribed
+	} else {
+		s.ready = c
+		s.spawn(s.run)
+	}
+	return c, nil
+}
+
+// SubscribeGroup is like Subscribe, yet the subscription is also a member of
+// group, as addressed by UpdateGroup.
+func (b *Broadcast) SubscribeGroup(notify chan<- interface{}, group string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if s != nil {
+		if group != "" {
+			s.group = group
+			if b.groups == nil {
+				b.groups = make(map[string][]*subscription)
+			}
+			b.groups[group] = insertByPriority(b.groups[group], s)
+		}
+		s.spawn(s.run)
+	}
+	return err
+}
+
+// UpdateGroup delivers v to the members of group only. The current version
+// remains unchanged, i.e., v is not stored nor retained, and it is dropped
+// during a Pause. The error is either from Validate, or ErrClosed after Close,
+// or nil.
+func (b *Broadcast) UpdateGroup(group string, v interface{}) error {
+	if b.Validate != nil {
+		if err := b.Validate(v); err != nil {
+			return err
+		}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if !b.paused {
+		m := message{v: v, at: clockOrSystem(b.Clock).Now()}
+		b.eachOf(b.groups[group], func(s *subscription) {
+			b.send(s, m)
+		})
+	}
+	return nil
+}
+
+// NotifyOnce delivers v to each of the current subscriptions, for transient
+// events such as a reload request. Unlike Update, v does not become the current
+// version, i.e., Load, Seq, History and SubscribeLatest are not affected, and
+// later subscriptions never see v. Subscriptions may coalesce v with other
+// values, as usual. NotifyOnce has no effect during a Pause or after Close.
+func (b *Broadcast) NotifyOnce(v interface{}) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed || b.paused {
 		return
 	}
+	m := message{v: v, at: clockOrSystem(b.Clock).Now()}
+	b.each(func(s *subscription) {
+		b.send(s, m)
+	})
+}
+
+// UpdateFunc delivers a value of choice to each subscription, as returned by
+// valueFor with the notify channel of the subscriber. The current version
+// remains unchanged, i.e., no value is stored nor retained, and the fan-out is
+// dropped during a Pause. A panic from valueFor skips the respective
+// subscriber only. The error is ErrClosed after Close, or it reports the first
+// panic recovered, if any.
+func (b *Broadcast) UpdateFunc(valueFor func(notify chan<- interface{}) interface{}) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if b.paused {
+		return nil
+	}
+
+	var err error
+	at := clockOrSystem(b.Clock).Now()
+	b.each(func(s *subscription) {
+		v, cause, ok := valueOf(valueFor, s.notify)
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("latest: UpdateFunc value panic: %v", cause)
+			}
+			b.log().Warnf("latest: UpdateFunc value panic recovered: %v", cause)
+			return
+		}
+		b.send(s, message{v: v, at: at})
+	})
+	return err
+}
+
+// valueOf invokes valueFor with a recover in place.
+func valueOf(valueFor func(chan<- interface{}) interface{}, notify chan<- interface{}) (v, cause interface{}, ok bool) {
+	defer func() {
+		if !ok {
+			cause = recover()
+		}
+	}()
+	return valueFor(notify), nil, true
+}
+
+// SubscribeLabeled is like Subscribe, yet the feed routine runs with labels,
+// as described by NewLabeledFeed.
+func (b *Broadcast) SubscribeLabeled(notify chan<- interface{}, labels pprof.LabelSet) error {
+	b.Lock()
+	defer b.Unlock()
 
+	s, err := b.subscribe(notify, 0)
+	if s != nil {
+		s.start = func() {
+			pprof.Do(context.Background(), labels, func(context.Context) {
+				s.run()
+			})
+		}
+		s.spawn(s.start)
+	}
+	return err
+}
+
+// SubscribeLatest adds an update receiver, and it returns the current version
+// in the same atomic step. This is the recommended way to join late. Ordering
+// is guaranteed as follows. Current is the version set by the last Update
+// which completed before the subscription. Each Update which completes after
+// goes to notify, subject to coalescing like any other subscription. No gap
+// nor duplicate occurs between current and the first value on notify, also
+// not over a Pause, as Resume skips notify when current is the version in
+// place. HadValue is false when no Update happened yet.
+// Duplicate subscriptions are ignored. Nothing is subscribed after Close, in
+// which case hadValue is false too.
+func (b *Broadcast) SubscribeLatest(notify chan<- interface{}) (current interface{}, hadValue bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	s, err := b.subscribe(notify, 0)
+	if err != nil {
+		return nil, false
+	}
+	if s != nil {
+		s.seen = b.seq
+		s.spawn(s.run)
+	}
+	return b.latest, b.hasLatest
+}
+
+// SubscribeWithCurrent is the former name of SubscribeLatest.
+//
+// Deprecated: Use SubscribeLatest instead.
+func (b *Broadcast) SubscribeWithCurrent(notify chan<- interface{}) (current interface{}, ok bool) {
+	return b.SubscribeLatest(notify)
+}
+
+// subscribe registers notify. The caller must start the routine of s. The
+// subscription is nil for duplicates, and the error is ErrClosed after Close.
+// The caller must hold the write lock.
+func (b *Broadcast) subscribe(notify chan<- interface{}, priority int) (*subscription, error) {
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if _, ok := b.feeds[notify]; ok {
+		return nil, nil // already subscribed
+	}
+	if b.MaxSubscribers > 0 && len(b.feeds) >= b.MaxSubscribers {
+		if b.LimitPolicy != EvictOldest || len(b.order) == 0 {
+			return nil, ErrFull
+		}
+		b.evictOldest()
+	}
+
+	s := newSubscription(notify)
+	b.joins++
+	s.join = b.joins
+	s.priority = priority
+	s.jitter = b.DeliveryJitter
+	s.maxAge = b.MaxAge
+	s.clone = b.Clone
+	s.clock = clockOrSystem(b.Clock)
+	s.idle = b.IdleTimeout
+	if b.Go != nil {
+		s.spawn = b.Go
+	}
+	s.events = &b.events
+	s.overload = &b.overload
+	s.caughtUp = &b.caughtUp
+	s.overloadAt = defaultOverloadThreshold
+	if b.OverloadThreshold > 0 {
+		s.overloadAt = int32(b.OverloadThreshold)
+	}
 	if b.feeds == nil {
-		b.feeds = make(map[chan<- interface{}]chan<- interface{})
+		b.feeds = make(map[chan<- interface{}]*subscription)
+	}
+	b.feeds[notify] = s
+
+	b.order = insertByPriority(b.order, s)
+
+	if len(b.feeds) > b.peak {
+		b.peak = len(b.feeds)
+	}
+	b.countChanged()
+	b.log().Debugf("latest: subscribe; %d subscriptions", len(b.feeds))
+	return s, nil
+}
+
+// evictOldest terminates the subscription which was made first. The caller
+// must hold the write lock.
+func (b *Broadcast) evictOldest() {
+	oldest := b.order[0]
+	for _, s := range b.order[1:] {
+		if s.join < oldest.join {
+			oldest = s
+		}
+	}
+	oldest.events.emit(EventEvicted, oldest.notify)
+	b.remove(oldest.notify)
+	b.log().Debugf("latest: subscription evicted on limit of %d", b.MaxSubscribers)
+
+	if f := b.OnEvict; f != nil {
+		oldest.spawn(func() {
+			<-oldest.exited
+			f(oldest.notify)
+		})
+	}
+}
+
+// compactMin is the subscription count needed, at some point in time, for an
+// empty map to be released. Smaller maps are kept for reuse, which prevents
+// allocation thrash when the count oscillates around zero.
+const compactMin = 64
+
+// releaseEmpty drops the map when empty, with respect to compactMin.
+// The caller must hold the write lock.
+func (b *Broadcast) releaseEmpty() {
+	if len(b.feeds) == 0 && b.peak >= compactMin {
+		b.feeds = nil
+		b.order = nil
+		b.peak = 0
+	}
+}
+
+// Mute suspends delivery to notify, including any pending value, while the
+// subscription stays in place.
+func (b *Broadcast) Mute(notify chan<- interface{}) {
+	b.Lock()
+	defer b.Unlock()
+
+	s, ok := b.feeds[notify]
+	if ok && !s.muted {
+		b.send(s, message{clear: true})
+		s.muted = true
+	}
+}
+
+// Unmute ends a Mute. The current version, if any, is delivered to notify.
+func (b *Broadcast) Unmute(notify chan<- interface{}) {
+	b.Lock()
+	defer b.Unlock()
+
+	s, ok := b.feeds[notify]
+	if ok && s.muted {
+		s.muted = false
+		if b.hasLatest {
+			b.send(s, message{v: b.latest, at: b.at})
+		}
 	}
-	b.feeds[notify] = feed
 }
 
 // Unsubscribe terminates a subscription.
@@ -79,28 +1091,539 @@ func (b *Broadcast) Unsubscribe(notify chan<- interface{}) {
 	b.Lock()
 	defer b.Unlock()
 
-	feed, ok := b.feeds[notify]
-	if ok {
-		delete(b.feeds, notify)
-		close(feed)
+	b.unsubscribe(notify)
+}
+
+// UnsubscribeWait is like Unsubscribe, yet it also awaits the feed routine to
+// exit, after which notify is no longer in use by b.
+func (b *Broadcast) UnsubscribeWait(notify chan<- interface{}) {
+	b.Lock()
+	s := b.unsubscribe(notify)
+	b.Unlock()
+
+	if s != nil {
+		<-s.exited
+	}
+}
+
+// unsubscribe terminates the subscription of notify, if any.
+// The caller must hold the write lock.
+func (b *Broadcast) unsubscribe(notify chan<- interface{}) *subscription {
+	s := b.remove(notify)
+	if s != nil {
+		b.releaseEmpty()
+		b.countChanged()
+	}
+	return s
+}
+
+// remove terminates the subscription of notify, if any, without any count
+// update. The caller must hold the write lock.
+func (b *Broadcast) remove(notify chan<- interface{}) *subscription {
+	s, ok := b.feeds[notify]
+	if !ok {
+		return nil
+	}
+	delete(b.feeds, notify)
+	b.order = without(b.order, s)
+	if s.group != "" {
+		b.groups[s.group] = without(b.groups[s.group], s)
+		if len(b.groups[s.group]) == 0 {
+			delete(b.groups, s.group)
+		}
 	}
+	s.stop()
+	b.dropped += atomic.LoadUint64(&s.drops)
+	b.log().Debugf("latest: unsubscribe; %d subscriptions", len(b.feeds))
+	return s
 }
 
 // UnsubscribeAll terminates all subscriptions.
 func (b *Broadcast) UnsubscribeAll() {
 	b.Lock()
 	defer b.Unlock()
+	b.unsubscribeAll()
+}
+
+// UnsubscribeAllAndFlush is like UnsubscribeAll, yet the current version, if
+// any, is delivered to each subscription once more before termination, as with
+// CloseAndFlush. Subscriptions made during the flush are terminated without it.
+// Updates may proceed during the flush, in which case the newer version takes
+// over, and the flush ends, such that no subscription ends with a stale value.
+// The error is ErrClosed after Close, and otherwise, it reports any
+// subscriptions which failed to confirm.
+func (b *Broadcast) UnsubscribeAllAndFlush(ctx context.Context) error {
+	b.Lock()
+	defer b.Unlock()
 
-	for notify, feed := range b.feeds {
+	if b.closed {
+		return ErrClosed
+	}
+	err := b.flush(ctx)
+	b.unsubscribeAll()
+	return err
+}
+
+// unsubscribeAll implements UnsubscribeAll. The caller must hold the write
+// lock.
+func (b *Broadcast) unsubscribeAll() {
+	if len(b.feeds) == 0 {
+		return
+	}
+	b.log().Debugf("latest: unsubscribe all %d subscriptions", len(b.feeds))
+	for notify, s := range b.feeds {
 		delete(b.feeds, notify)
-		close(feed)
+		s.stop()
+		b.dropped += atomic.LoadUint64(&s.drops)
+	}
+	for i := range b.order {
+		b.order[i] = nil // release
+	}
+	b.order = b.order[:0]
+	b.groups = nil
+	b.releaseEmpty()
+	b.countChanged()
+}
+
+// flush delivers the current version, if any, to each subscription, in order
+// of priority. Each priority tier must confirm, as with UpdateWait, before the
+// next tier gets the value, such that critical subscribers, e.g., persistence,
+// are done first. Subscriptions which terminate in the mean time, and muted
+// subscriptions, are skipped. An Update in the mean time ends the flush, as
+// the fan-out passed the newer version to the remaining tiers already. The
+// error reports any subscriptions which failed to confirm within ctx. The
+// caller must hold the write lock, which is released during each wait.
+func (b *Broadcast) flush(ctx context.Context) error {
+	if !b.hasLatest {
+		return nil
+	}
+	seq := b.seq
+	list := append([]*subscription(nil), b.order...) // snapshot
+
+	var sent, confirmed int
+	var err error
+	for i := 0; i < len(list) && err == nil; {
+		if b.seq != seq && !b.held {
+			break // newer version delivered by Update
+		}
+
+		// range of equal priority
+		end := i + 1
+		for end < len(list) && list[end].priority == list[i].priority {
+			end++
+		}
+
+		confirm := make(chan bool, end-i)
+		var pending int
+		b.eachOf(list[i:end], func(s *subscription) {
+			if b.feeds[s.notify] != s {
+				return // terminated
+			}
+			if b.send(s, message{v: b.latest, at: b.at, confirm: confirm}) {
+				pending++
+			}
+		})
+		i = end
+		sent += pending
+
+		// await confirmation without lock
+		b.Unlock()
+		for ; pending > 0 && err == nil; pending-- {
+			select {
+			case ok := <-confirm:
+				if ok {
+					confirmed++
+				}
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		b.Lock()
+	}
+
+	switch {
+	case confirmed == sent:
+		return nil
+	case err != nil:
+		return fmt.Errorf("latest: flush confirmed by %d of %d subscriptions: %v", confirmed, sent, err)
+	default:
+		return fmt.Errorf("latest: flush confirmed by %d of %d subscriptions", confirmed, sent)
+	}
+}
+
+// ReplaceSubscribers reconciles the subscriptions with notifies in one atomic
+// step. Channels not in notifies are unsubscribed, and channels new to b are
+// subscribed, as with Subscribe. Subscriptions which remain are left as is,
+// including any value pending. Updates do not interleave with the swap, i.e.,
+// each update goes either to the old set or to the new set. The error is
+// ErrClosed after Close, and ErrFull when notifies exceeds MaxSubscribers,
+// with either policy, in which case nothing changes. No channel in notifies
+// is evicted by EvictOldest.
+func (b *Broadcast) ReplaceSubscribers(notifies []chan<- interface{}) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	keep := make(map[chan<- interface{}]bool, len(notifies))
+	for _, notify := range notifies {
+		keep[notify] = true
+	}
+	if b.MaxSubscribers > 0 && len(keep) > b.MaxSubscribers {
+		return ErrFull
 	}
+	for notify := range b.feeds {
+		if !keep[notify] {
+			b.unsubscribe(notify)
+		}
+	}
+	// capacity checked in advance, so no eviction nor ErrFull
+	for _, notify := range notifies {
+		s, err := b.subscribe(notify, 0)
+		if err != nil {
+			return err
+		}
+		if s != nil {
+			s.spawn(s.run)
+		}
+	}
+	return nil
+}
+
+// UnsubscribeWhere terminates each subscription of which the notify channel
+// matches pred, in one atomic step. The return is the number of subscriptions
+// terminated. Pred is invoked with the write lock held, so it must not call
+// methods on b.
+func (b *Broadcast) UnsubscribeWhere(pred func(notify chan<- interface{}) bool) int {
+	b.Lock()
+	defer b.Unlock()
+
+	var n int
+	for notify := range b.feeds {
+		if pred(notify) {
+			b.remove(notify)
+			n++
+		}
+	}
+	if n != 0 {
+		b.releaseEmpty()
+		b.countChanged()
+	}
+	return n
+}
+
+// Compact releases any memory retained from past subscriptions. Maps do not
+// shrink in Go, so a Broadcast which had many subscriptions keeps the space,
+// even after most of them ended.
+func (b *Broadcast) Compact() {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.feeds) == 0 {
+		b.feeds = nil
+		b.order = nil
+	} else {
+		feeds := make(map[chan<- interface{}]*subscription, len(b.feeds))
+		for notify, s := range b.feeds {
+			feeds[notify] = s
+		}
+		b.feeds = feeds
+		b.order = append([]*subscription(nil), b.order...)
+	}
+	b.peak = len(b.feeds)
+}
+
+// Close terminates all subscriptions, and it makes any further Update or
+// Subscribe fail with ErrClosed. Close is idempotent. Any CloseAndFlush in
+// progress is awaited.
+func (b *Broadcast) Close() {
+	b.Lock()
+	hooks := b.close()
+	flushing := b.flushing
+	b.Unlock()
+
+	for _, f := range hooks {
+		f()
+	}
+	if flushing != nil {
+		<-flushing
+	}
+}
+
+// CloseAndFlush is like Close, yet the current version, if any, is delivered
+// to each subscription once more, to be confirmed within ctx, as with
+// UpdateWait, before termination. Delivery goes in order of priority, with
+// each priority tier confirmed before the next one starts. Update and
+// Subscribe fail with ErrClosed from the start of the flush. The error is
+// ErrClosed when b was closed already, and otherwise, it reports any
+// subscriptions which failed to confirm.
+func (b *Broadcast) CloseAndFlush(ctx context.Context) error {
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return ErrClosed
+	}
+	b.closed = true
+	b.flushing = make(chan struct{})
+	err := b.flush(ctx)
+	hooks := b.shutdown()
+	b.Unlock()
+
+	for _, f := range hooks {
+		f()
+	}
+	close(b.flushing)
+	return err
 }
 
-// SubscriptionCount returns the number of active subscriptions.
+// close implements Close, and it returns the hooks, if any, for invocation
+// after the write lock is released. The caller must hold the write lock.
+func (b *Broadcast) close() (hooks []func()) {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	return b.shutdown()
+}
+
+// shutdown terminates all subscriptions after the closed flag is set, and it
+// returns the hooks, if any, for invocation after the write lock is released.
+// The caller must hold the write lock.
+func (b *Broadcast) shutdown() (hooks []func()) {
+	hooks, b.onClose = b.onClose, nil
+	b.log().Debugf("latest: close with %d subscriptions", len(b.feeds))
+
+	for _, s := range b.feeds {
+		s.stop()
+		b.dropped += atomic.LoadUint64(&s.drops)
+	}
+	b.feeds = nil
+	b.order = nil
+	b.groups = nil
+	b.peak = 0
+	atomic.StoreInt32(&b.count, 0)
+	if b.cond != nil {
+		b.cond.Broadcast()
+	}
+	if b.pool != nil {
+		b.pool.stop()
+	}
+	if b.countFeed != nil {
+		b.countFeed <- 0
+		close(b.countFeed)
+		b.countFeed = nil
+	}
+	return hooks
+}
+
+// SubscriptionCount returns the number of active subscriptions. The read is
+// lock-free, i.e., it does not wait for any fan-out in progress.
 func (b *Broadcast) SubscriptionCount() int {
+	return int(atomic.LoadInt32(&b.count))
+}
+
+// CountChanges returns a channel which receives the number of subscriptions
+// each time it changes, starting with the current count. Slow receivers get
+// the latest count only, as with NewFeed. All invocations return the same
+// channel. The first call starts a routine which lives until Close. The final
+// count, zero, is delivered after Close, and then the channel is closed, such
+// that range loops end naturally. A first call after Close gets a closed
+// channel, with the final count still pending.
+func (b *Broadcast) CountChanges() <-chan int {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.countNotify == nil && b.closed {
+		c := make(chan int, 1)
+		c <- 0 // final count
+		close(c)
+		b.countNotify = c
+	}
+	if b.countNotify == nil {
+		b.countNotify = make(chan int)
+		spawn := b.Go
+		if spawn == nil {
+			spawn = goStatement
+		}
+		b.countFeed = newCountFeed(b.countNotify, spawn)
+		b.countFeed <- len(b.feeds)
+	}
+	return b.countNotify
+}
+
+// countChanged registers the subscription count, and it submits the count to
+// CountChanges, if any. The caller must hold the write lock.
+func (b *Broadcast) countChanged() {
+	atomic.StoreInt32(&b.count, int32(len(b.feeds)))
+	if b.countFeed != nil {
+		b.countFeed <- len(b.feeds)
+	}
+}
+
+// newCountFeed is the int equivalent of NewFeed, yet any count pending on
+// closure of the input is delivered before notify is closed. The routine
+// starts with spawn.
+func newCountFeed(notify chan<- int, spawn func(func())) chan<- int {
+	feed := make(chan int)
+
+	spawn(func() {
+		defer close(notify)
+		for {
+			// await update
+			latest, ok := <-feed
+			if !ok {
+				return
+			}
+			for {
+				select {
+				case next, ok := <-feed:
+					if !ok {
+						notify <- latest // final count
+						return
+					}
+					latest = next
+					continue // newer update
+
+				case notify <- latest:
+					break // update delivered
+				}
+				break
+			}
+		}
+	})
+
+	return feed
+}
+
+// Load returns the current version. The ok flag is false when no Update
+// happened yet.
+func (b *Broadcast) Load() (current interface{}, ok bool) {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.latest, b.hasLatest
+}
+
+// State returns the current version together with its sequence number, as
+// described by Seq, and the moment it was set, all from the same snapshot.
+// The ok flag is false when no Update happened yet.
+func (b *Broadcast) State() (current interface{}, seq uint64, at time.Time, ok bool) {
 	b.RLock()
 	defer b.RUnlock()
 
-	return len(b.feeds)
+	return b.latest, b.seq, b.at, b.hasLatest
+}
+
+// Status returns the current version together with the subscription count and
+// the moment of the last update, all from the same snapshot, as a consistent
+// read for health checks. HasValue is false when no Update happened yet.
+func (b *Broadcast) Status() (value interface{}, hasValue bool, subscribers int, lastUpdate time.Time) {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.latest, b.hasLatest, len(b.feeds), b.at
+}
+
+// AllCurrent returns whether none of the subscriptions has a value pending,
+// i.e., whether each receiver is caught up with the latest value sent to it.
+// Subscriptions without any update count as current. The return is false
+// while an Update is withheld on Pause. Phased operations may poll AllCurrent
+// before they move on, or they may use WaitIdle instead.
+func (b *Broadcast) AllCurrent() bool {
+	b.RLock()
+	defer b.RUnlock()
+
+	if b.held {
+		return false
+	}
+	for _, s := range b.order {
+		if !s.isCurrent() {
+			return false
+		}
+	}
+	return true
+}
+
+// Seq returns the number of versions set so far. The sequence is monotonic,
+// such that observers can tell how far behind they are.
+func (b *Broadcast) Seq() uint64 {
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.seq
+}
+
+// Stats returns a snapshot of the counters.
+func (b *Broadcast) Stats() Stats {
+	b.RLock()
+	defer b.RUnlock()
+
+	stats := Stats{Timeouts: b.timeouts, Drops: b.dropped}
+	for _, s := range b.order {
+		stats.Drops += atomic.LoadUint64(&s.drops)
+	}
+	return stats
+}
+
+// SubStat holds the counters of one subscription.
+type SubStat struct {
+	// Notify identifies the subscriber by its channel. Callbacks from
+	// SubscribeFunc have an internal channel, for identity only.
+	Notify chan<- interface{}
+
+	Delivered    uint64    // number of values passed
+	Dropped      uint64    // number of values discarded
+	LastDelivery time.Time // zero for none
+}
+
+// SubscriberStats returns the counters of each subscription, in fan-out order.
+// Counters are read one by one, so they may be off by an update in progress.
+func (b *Broadcast) SubscriberStats() []SubStat {
+	b.RLock()
+	defer b.RUnlock()
+
+	stats := make([]SubStat, len(b.order))
+	for i, s := range b.order {
+		stats[i] = SubStat{
+			Notify:    s.notify,
+			Delivered: atomic.LoadUint64(&s.delivered),
+			Dropped:   atomic.LoadUint64(&s.drops),
+		}
+		if ns := atomic.LoadInt64(&s.lastDelivery); ns != 0 {
+			stats[i].LastDelivery = time.Unix(0, ns)
+		}
+	}
+	return stats
+}
+
+// Subscriber is the receiving side of a Broadcast.
+type Subscriber interface {
+	Subscribe(notify chan<- interface{}) error
+	Unsubscribe(notify chan<- interface{})
+	SubscriptionCount() int
+}
+
+// ReadOnly returns a view on b which can not Update. Type assertion on the
+// view does not reveal b.
+func (b *Broadcast) ReadOnly() Subscriber {
+	return readOnly{b}
+}
+
+// readOnly implements ReadOnly.
+type readOnly struct {
+	b *Broadcast
+}
+
+func (r readOnly) Subscribe(notify chan<- interface{}) error {
+	return r.b.Subscribe(notify)
+}
+
+func (r readOnly) Unsubscribe(notify chan<- interface{}) {
+	r.b.Unsubscribe(notify)
+}
+
+func (r readOnly) SubscriptionCount() int {
+	return r.b.SubscriptionCount()
 }
@@ -0,0 +1,2052 @@
+package latest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendTimeout(t *testing.T) {
+	b := Broadcast{SendTimeout: time.Millisecond}
+	// simulate a wedged feed routine
+	wedged := make(chan interface{})
+	s := newSubscription(wedged)
+	b.feeds = map[chan<- interface{}]*subscription{wedged: s}
+	b.order = []*subscription{s}
+
+	b.Update("skip")
+	if got := b.Stats().Timeouts; got != 1 {
+		t.Errorf("got %d timeouts, want 1", got)
+	}
+}
+
+func TestCountChanges(t *testing.T) {
+	var b Broadcast
+	counts := b.CountChanges()
+	if got := <-counts; got != 0 {
+		t.Errorf("got initial count %d, want 0", got)
+	}
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	if got := <-counts; got != 1 {
+		t.Errorf("got count %d after Subscribe, want 1", got)
+	}
+
+	// churn collapses to the latest
+	b.Subscribe(make(chan interface{}))
+	b.Subscribe(make(chan interface{}))
+	b.UnsubscribeAll()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case got := <-counts:
+			if got == 0 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("count 0 not received after UnsubscribeAll")
+		}
+	}
+}
+
+func TestCountChangesClose(t *testing.T) {
+	var b Broadcast
+	counts := b.CountChanges()
+	<-counts // initial
+	b.Subscribe(make(chan interface{}))
+	b.Close()
+
+	last := -1
+	for n := range counts {
+		last = n
+	}
+	if last != 0 {
+		t.Errorf("got final count %d, want 0", last)
+	}
+}
+
+func TestCountChangesAfterClose(t *testing.T) {
+	var b Broadcast
+	b.Close()
+
+	var counts []int
+	for n := range b.CountChanges() {
+		counts = append(counts, n)
+	}
+	if len(counts) != 1 || counts[0] != 0 {
+		t.Errorf("got counts %v, want [0]", counts)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var b Broadcast
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+
+	b.Close()
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions after Close, want 0", n)
+	}
+	if err := b.Update("late"); err != ErrClosed {
+		t.Errorf("Update after Close got error %v, want ErrClosed", err)
+	}
+	if err := b.Subscribe(notify); err != ErrClosed {
+		t.Errorf("Subscribe after Close got error %v, want ErrClosed", err)
+	}
+	if _, ok := b.SubscribeWithCurrent(notify); ok {
+		t.Error("SubscribeWithCurrent after Close got ok")
+	}
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions after Close, want 0", n)
+	}
+	b.Close() // idempotent
+}
+
+func TestNewLabeledFeed(t *testing.T) {
+	notify := make(chan interface{})
+	update := NewLabeledFeed(notify, pprof.Labels("subscriber", "test"))
+	defer close(update)
+
+	update <- 42
+	if got := <-notify; got != 42 {
+		t.Errorf("got %v, want 42", got)
+	}
+
+	var dump bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&dump, 1)
+	if !strings.Contains(dump.String(), `"subscriber":"test"`) {
+		t.Errorf("label absent in goroutine dump:\n%s", dump.String())
+	}
+}
+
+func TestReleaseEmpty(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	// oscillation keeps the map
+	for i := 0; i < 3; i++ {
+		notify := make(chan interface{})
+		b.Subscribe(notify)
+		b.Unsubscribe(notify)
+		if b.feeds == nil {
+			t.Fatal("small map released")
+		}
+	}
+
+	notifies := make([]chan interface{}, compactMin)
+	for i := range notifies {
+		notifies[i] = make(chan interface{})
+		b.Subscribe(notifies[i])
+	}
+	for _, notify := range notifies {
+		b.Unsubscribe(notify)
+	}
+	if b.feeds != nil {
+		t.Error("large map retained when empty")
+	}
+}
+
+func TestNewFeedErrs(t *testing.T) {
+	notify := make(chan interface{})
+	feed, errs := NewFeedErrs(notify)
+	close(notify)
+
+	feed <- "send on closed channel"
+	if err := <-errs; err == nil {
+		t.Error("got no error for panic")
+	} else if !strings.Contains(err.Error(), "closed channel") {
+		t.Errorf("got error %q, want send on closed channel", err)
+	}
+
+	feed <- "discarded" // must not block
+	close(feed)
+	if err, ok := <-errs; ok {
+		t.Errorf("got error %v after close, want closed channel", err)
+	}
+}
+
+func TestUpdateTracked(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	ready := make(chan interface{}, 1) // buffer accepts without delay
+	busy := make(chan interface{})     // no receiver
+	b.Subscribe(ready)
+	b.Subscribe(busy)
+
+	delivered, err := b.UpdateTracked("v1")
+	if err != nil {
+		t.Fatal("UpdateTracked error:", err)
+	}
+	if len(delivered) != 1 || delivered[0] != chan<- interface{}(ready) {
+		t.Errorf("got delivered %v, want the ready channel only", delivered)
+	}
+	if got := <-ready; got != "v1" {
+		t.Errorf("ready got %v, want v1", got)
+	}
+	// pending value remains
+	if got := <-busy; got != "v1" {
+		t.Errorf("busy got %v, want v1", got)
+	}
+}
+
+func TestDeliveryJitter(t *testing.T) {
+	b := Broadcast{DeliveryJitter: 10 * time.Millisecond}
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Update("v1")
+	b.Update("v2") // coalesces during the delay
+	select {
+	case got := <-notify:
+		if got != "v2" {
+			t.Errorf("got %v, want v2", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+	}
+}
+
+func TestNegativeDurations(t *testing.T) {
+	b := Broadcast{
+		DeliveryJitter: -time.Second,
+		MaxAge:         -time.Second,
+		IdleTimeout:    -time.Second,
+	}
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Update("v1")
+	select {
+	case got := <-notify:
+		if got != "v1" {
+			t.Errorf("got %v, want v1", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+	}
+}
+
+func TestState(t *testing.T) {
+	var b Broadcast
+	if _, seq, at, ok := b.State(); ok || seq != 0 || !at.IsZero() {
+		t.Errorf("got seq %d at %s with ok %t, want zero state", seq, at, ok)
+	}
+
+	before := time.Now()
+	b.Update("v1")
+	b.Update("v2")
+	v, seq, at, ok := b.State()
+	if !ok || v != "v2" || seq != 2 || at.Before(before) {
+		t.Errorf("got %v with seq %d at %s and ok %t, want v2 with seq 2 after %s", v, seq, at, ok, before)
+	}
+	if v, ok := b.Load(); !ok || v != "v2" {
+		t.Errorf("Load got %v with ok %t, want v2", v, ok)
+	}
+}
+
+func TestSubscribePriority(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	low, mid1, mid2, high := make(chan interface{}), make(chan interface{}), make(chan interface{}), make(chan interface{})
+	b.SubscribePriority(low, -1)
+	b.Subscribe(mid1)
+	b.SubscribePriority(high, 9)
+	b.Subscribe(mid2)
+
+	lasts := make(map[chan<- interface{}]bool)
+	for i := 0; i < 2; i++ {
+		var got []chan<- interface{}
+		b.each(func(s *subscription) {
+			got = append(got, s.notify)
+		})
+		if len(got) != 4 || got[0] != chan<- interface{}(high) || got[3] != chan<- interface{}(low) {
+			t.Fatalf("fan-out %d out of priority order", i)
+		}
+		lasts[got[2]] = true
+	}
+	if len(lasts) != 2 {
+		t.Error("ties did not rotate")
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	b := Broadcast{MaxAge: 50 * time.Millisecond}
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Update("stale")
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case v := <-notify:
+		t.Errorf("got %v after MaxAge", v)
+	default:
+		break
+	}
+
+	b.Update("fresh")
+	if got := <-notify; got != "fresh" {
+		t.Errorf("got %v, want fresh", got)
+	}
+}
+
+// fakeClock is a Clock which only moves on Advance.
+type fakeClock struct {
+	sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	added   chan struct{} // signals After
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1e9, 0), added: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+	w := fakeWaiter{c.now.Add(d), make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	c.added <- struct{}{}
+	return w.c
+}
+
+// Advance moves the time, and it fires any waiters due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+func TestMaxAgeClock(t *testing.T) {
+	clock := newFakeClock()
+	b := Broadcast{MaxAge: time.Minute, Clock: clock}
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Update("stale")
+	<-clock.added // expiry timer
+	clock.Advance(time.Minute)
+	time.Sleep(10 * time.Millisecond)
+
+	select {
+	case v := <-notify:
+		t.Errorf("got %v after MaxAge", v)
+	default:
+		break
+	}
+	if got := b.Stats().Drops; got != 1 {
+		t.Errorf("got %d drops, want 1", got)
+	}
+
+	b.Update("fresh")
+	<-clock.added
+	clock.Advance(time.Minute - time.Nanosecond)
+	if got := <-notify; got != "fresh" {
+		t.Errorf("got %v, want fresh", got)
+	}
+}
+
+func TestUnsubscribeWait(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Update("pending")
+	b.UnsubscribeWait(notify)
+
+	close(notify) // no send on closed channel
+	if _, ok := <-notify; ok {
+		t.Error("got delivery after UnsubscribeWait")
+	}
+}
+
+func TestStatsDrops(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Update(1)
+	b.Update(2)
+	b.Update(3)
+	<-notify
+	if got := b.Stats().Drops; got != 2 {
+		t.Errorf("got %d drops, want 2", got)
+	}
+
+	b.Unsubscribe(notify)
+	if got := b.Stats().Drops; got != 2 {
+		t.Errorf("got %d drops after Unsubscribe, want 2", got)
+	}
+}
+
+func TestSubscribeFuncPool(t *testing.T) {
+	b := Broadcast{Workers: 3}
+	defer b.Close()
+
+	const n = 100
+	got := make(chan interface{}, n)
+	for i := 0; i < n; i++ {
+		b.SubscribeFunc(func(v interface{}) {
+			if v == "final" {
+				got <- v
+			}
+		})
+	}
+	if c := b.SubscriptionCount(); c != n {
+		t.Fatalf("got %d subscriptions, want %d", c, n)
+	}
+
+	for i := 0; i < 10; i++ {
+		b.Update(i)
+	}
+	b.Update("final")
+	timeout := time.After(time.Second)
+	for i := 0; i < n; i++ {
+		select {
+		case <-got:
+			break
+		case <-timeout:
+			t.Fatalf("%d callbacks got the final value, want %d", i, n)
+		}
+	}
+}
+
+func TestSubscribeFuncPoolClose(t *testing.T) {
+	b := Broadcast{Workers: 1}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	b.SubscribeFunc(func(interface{}) {
+		close(started)
+		<-release
+	})
+	b.Update("busy")
+	<-started
+
+	// scheduled behind the busy worker
+	var buf bytes.Buffer
+	errs, _, err := b.SubscribeRelay(&buf, json.Marshal)
+	if err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	b.Close()
+	select {
+	case err, ok := <-errs:
+		if ok {
+			t.Errorf("got error %v, want closed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("errs not closed after Close")
+	}
+}
+
+func TestWait(t *testing.T) {
+	var b Broadcast
+	b.Update("v1")
+	if got := b.Wait(0); got != 1 {
+		t.Errorf("got sequence %d, want 1", got)
+	}
+
+	woke := make(chan uint64)
+	go func() {
+		woke <- b.Wait(1)
+	}()
+	b.Update("v2")
+	b.Update("v3")
+	if got := <-woke; got < 2 {
+		t.Errorf("got sequence %d, want 2 or more", got)
+	}
+
+	go func() {
+		woke <- b.Wait(b.Seq())
+	}()
+	b.Close()
+	if got := <-woke; got != 3 {
+		t.Errorf("got sequence %d after Close, want 3", got)
+	}
+}
+
+func TestSubscribeConfirmed(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	notify := make(chan interface{})
+	ready, err := b.SubscribeConfirmed(notify)
+	if err != nil {
+		t.Fatal("SubscribeConfirmed error:", err)
+	}
+	<-ready
+	b.Update("v1")
+	if got := <-notify; got != "v1" {
+		t.Errorf("got %v, want v1", got)
+	}
+
+	dupe, _ := b.SubscribeConfirmed(notify)
+	<-dupe
+
+	b.Close()
+	if _, err := b.SubscribeConfirmed(notify); err != ErrClosed {
+		t.Errorf("got error %v after Close, want ErrClosed", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	var b Broadcast
+	events := b.Events()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	b.Update(1)
+	b.Update(2)
+	b.Update(3)
+	time.Sleep(10 * time.Millisecond)
+	if got := <-notify; got != 3 {
+		t.Errorf("got %v, want 3", got)
+	}
+	b.UnsubscribeWait(notify)
+
+	var coalesced, delivered, closed int
+	for len(events) != 0 {
+		e := <-events
+		if e.Notify != notify {
+			t.Errorf("got event for channel %v, want %v", e.Notify, notify)
+		}
+		switch e.Kind {
+		case EventCoalesced:
+			coalesced++
+		case EventDelivered:
+			delivered++
+		case EventClosed:
+			closed++
+		}
+	}
+	if coalesced != 2 || delivered != 1 || closed != 1 {
+		t.Errorf("got %d coalesced, %d delivered and %d closed; want 2, 1 and 1", coalesced, delivered, closed)
+	}
+}
+
+func TestReplaceSubscribers(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	a := make(chan interface{}, 1)
+	c := make(chan interface{}, 1)
+	d := make(chan interface{}, 1)
+	b.Subscribe(a)
+	b.Subscribe(c)
+	b.Update("pending")
+	time.Sleep(10 * time.Millisecond)
+	<-a // buffer space for next
+
+	if err := b.ReplaceSubscribers([]chan<- interface{}{c, d}); err != nil {
+		t.Fatal("replace error:", err)
+	}
+	if n := b.SubscriptionCount(); n != 2 {
+		t.Errorf("got %d subscriptions, want 2", n)
+	}
+	if got := <-c; got != "pending" {
+		t.Errorf("retained subscription got %v, want pending", got)
+	}
+
+	b.Update("next")
+	if got := <-c; got != "next" {
+		t.Errorf("retained subscription got %v, want next", got)
+	}
+	if got := <-d; got != "next" {
+		t.Errorf("new subscription got %v, want next", got)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(a) != 0 {
+		t.Error("removed subscription got update")
+	}
+}
+
+func TestReplaceSubscribersLimit(t *testing.T) {
+	for _, policy := range []LimitPolicy{RejectNew, EvictOldest} {
+		b := Broadcast{MaxSubscribers: 2, LimitPolicy: policy}
+		a, x := make(chan interface{}), make(chan interface{})
+		c, d := make(chan interface{}), make(chan interface{})
+		b.Subscribe(a)
+		b.Subscribe(x)
+		subscribed := func(notify chan interface{}) bool {
+			b.RLock()
+			defer b.RUnlock()
+			_, ok := b.feeds[notify]
+			return ok
+		}
+
+		if err := b.ReplaceSubscribers([]chan<- interface{}{a, c, d}); err != ErrFull {
+			t.Errorf("policy %d: got error %v, want ErrFull", policy, err)
+		}
+		if !subscribed(a) || !subscribed(x) || b.SubscriptionCount() != 2 {
+			t.Errorf("policy %d: subscriptions changed on ErrFull", policy)
+		}
+
+		if err := b.ReplaceSubscribers([]chan<- interface{}{a, c}); err != nil {
+			t.Errorf("policy %d: got error %v", policy, err)
+		}
+		if !subscribed(a) || !subscribed(c) || subscribed(x) {
+			t.Errorf("policy %d: want a and c subscribed only", policy)
+		}
+		b.Close()
+	}
+}
+
+func TestUpdateWait(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	ready := make(chan interface{})
+	stuck := make(chan interface{})
+	b.Subscribe(ready)
+	b.Subscribe(stuck)
+	go func() {
+		for range ready {
+		}
+	}()
+	defer func() {
+		b.UnsubscribeWait(ready)
+		close(ready)
+	}()
+
+	start := time.Now()
+	n, err := b.UpdateWait("final", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal("update error:", err)
+	}
+	if n != 1 {
+		t.Errorf("got %d confirmed, want 1", n)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("returned after %s, want timeout for stuck subscriber", d)
+	}
+
+	// coalescing ends the wait before timeout
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Update("override")
+	}()
+	start = time.Now()
+	n, err = b.UpdateWait("replaced", time.Second)
+	if err != nil {
+		t.Fatal("update error:", err)
+	}
+	if n != 1 {
+		t.Errorf("got %d confirmed, want 1", n)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("returned after %s, want early return on coalescing", d)
+	}
+}
+
+func TestUpdateFuncPanic(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	good1 := make(chan interface{}, 1)
+	bad := make(chan interface{}, 1)
+	good2 := make(chan interface{}, 1)
+	b.Subscribe(good1)
+	b.Subscribe(bad)
+	b.Subscribe(good2)
+
+	err := b.UpdateFunc(func(notify chan<- interface{}) interface{} {
+		if notify == bad {
+			panic("no value")
+		}
+		return "ok"
+	})
+	if err == nil || !strings.Contains(err.Error(), "no value") {
+		t.Errorf("got error %v, want panic cause", err)
+	}
+
+	for _, c := range []chan interface{}{good1, good2} {
+		select {
+		case got := <-c:
+			if got != "ok" {
+				t.Errorf("got %v, want ok", got)
+			}
+		case <-time.After(time.Second):
+			t.Error("no delivery after panic of other subscriber")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(bad) != 0 {
+		t.Errorf("panic subscriber got %v", <-bad)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	if _, ok, n, at := b.Status(); ok || n != 0 || !at.IsZero() {
+		t.Errorf("initial status got %t, %d, %s; want false, 0, zero", ok, n, at)
+	}
+
+	b.Subscribe(make(chan interface{}))
+	before := time.Now()
+	b.Update("v")
+	v, ok, n, at := b.Status()
+	if v != "v" || !ok || n != 1 || at.Before(before) {
+		t.Errorf("got status %v, %t, %d, %s; want v, true, 1, after %s", v, ok, n, at, before)
+	}
+}
+
+func TestPressureFeed(t *testing.T) {
+	notify := make(chan interface{})
+	feed := NewPressureFeed(notify)
+	defer feed.Close()
+
+	if p := feed.Pressure(); p != 0 {
+		t.Errorf("initial pressure got %d, want 0", p)
+	}
+	feed.Send("v")
+	feed.Send("v") // routine passed first store
+	if p := feed.Pressure(); p != 1 {
+		t.Errorf("pressure with receiver behind got %d, want 1", p)
+	}
+	<-notify
+	time.Sleep(10 * time.Millisecond)
+	if p := feed.Pressure(); p != 0 {
+		t.Errorf("pressure after catch up got %d, want 0", p)
+	}
+}
+
+func TestSubscribeContextCancelled(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	routines := runtime.NumGoroutine()
+	if err := b.SubscribeContext(ctx, make(chan interface{})); err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions, want 0", n)
+	}
+	if n := runtime.NumGoroutine(); n != routines {
+		t.Errorf("got %d goroutines, want %d", n, routines)
+	}
+}
+
+func TestSubscribeContext(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := b.SubscribeContext(ctx, make(chan interface{})); err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	if n := b.SubscriptionCount(); n != 1 {
+		t.Errorf("got %d subscriptions, want 1", n)
+	}
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions after cancel, want 0", n)
+	}
+}
+
+func TestUpdateQuorum(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	replica := make(chan interface{}, 1)
+	stuck := make(chan interface{})
+	b.Subscribe(replica)
+	b.Subscribe(stuck)
+
+	start := time.Now()
+	acked, err := b.UpdateQuorum("v1", 1, time.Second)
+	if err != nil || acked != 1 {
+		t.Errorf("got %d acks with error %v, want 1 without error", acked, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("quorum took %s", d)
+	}
+	<-replica
+
+	acked, err = b.UpdateQuorum("v2", 2, 20*time.Millisecond)
+	if err != ErrQuorum || acked != 1 {
+		t.Errorf("got %d acks with error %v, want 1 with ErrQuorum", acked, err)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	notify := make(chan interface{}, 2)
+	notify <- "a"
+	notify <- "bc"
+	close(notify)
+
+	var buf bytes.Buffer
+	enc := func(v interface{}) ([]byte, error) {
+		return []byte(v.(string)), nil
+	}
+	if err := Relay(&buf, notify, enc); err != nil {
+		t.Fatal("relay error:", err)
+	}
+	const want = "\x00\x00\x00\x01a\x00\x00\x00\x02bc"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConsumeRelayPartial(t *testing.T) {
+	// length prefix announces more than available
+	r := strings.NewReader("\x00\x00\x00\x01a\x00\x00\x00\x05ab")
+	b, stop, errs := ConsumeRelay(r, func(p []byte) (interface{}, error) {
+		return string(p), nil
+	})
+	defer stop()
+
+	if err := <-errs; err != io.ErrUnexpectedEOF {
+		t.Errorf("got error %v, want io.ErrUnexpectedEOF", err)
+	}
+	if v, _ := b.Load(); v != "a" {
+		t.Errorf("got %v, want frame before the partial one only", v)
+	}
+	if err := b.Update("x"); err != ErrClosed {
+		t.Errorf("got update error %v, want ErrClosed", err)
+	}
+}
+
+func TestConsumeRelayMalformed(t *testing.T) {
+	malformed := errors.New("malformed")
+	r := strings.NewReader("\x00\x00\x00\x01a")
+	_, stop, errs := ConsumeRelay(r, func(p []byte) (interface{}, error) {
+		return nil, malformed
+	})
+	defer stop()
+
+	if err := <-errs; err != malformed {
+		t.Errorf("got error %v, want %v", err, malformed)
+	}
+	if _, ok := <-errs; ok {
+		t.Error("errs not closed after error")
+	}
+}
+
+func TestConsumeRelayEOF(t *testing.T) {
+	_, stop, errs := ConsumeRelay(strings.NewReader("\x00\x00\x00\x01a"), func(p []byte) (interface{}, error) {
+		return string(p), nil
+	})
+	defer stop()
+
+	if err, ok := <-errs; ok {
+		t.Errorf("got error %v on end of frame boundary, want closed", err)
+	}
+}
+
+// failWriter fails each write.
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestSubscribeRelayFail(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	b.Update("current")
+	errs, _, err := b.SubscribeRelay(failWriter{}, func(v interface{}) ([]byte, error) {
+		return []byte(v.(string)), nil
+	})
+	if err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil || err.Error() != "write failed" {
+			t.Errorf("got error %v, want write failed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error on relay of current version")
+	}
+
+	if _, ok := <-errs; ok {
+		t.Error("errs not closed after error")
+	}
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions after error, want 0", n)
+	}
+}
+
+func TestSubscribeRelayCancel(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	var buf bytes.Buffer
+	errs, cancel, err := b.SubscribeRelay(&buf, json.Marshal)
+	if err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	cancel()
+	if err, ok := <-errs; ok {
+		t.Errorf("got error %v after cancel, want closed", err)
+	}
+
+	errs, _, err = b.SubscribeRelay(&buf, json.Marshal)
+	if err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	b.Close()
+	if err, ok := <-errs; ok {
+		t.Errorf("got error %v after Close, want closed", err)
+	}
+}
+
+func TestAdaptiveFeed(t *testing.T) {
+	notify := make(chan interface{})
+	sum := func(acc, next interface{}) interface{} {
+		return acc.(int) + next.(int)
+	}
+	feed := NewAdaptiveFeed(notify, sum, 2)
+	defer feed.Close()
+
+	// receiver behind: 1 and 2 replaced, then merge
+	for i := 1; i <= 5; i++ {
+		feed.Send(i)
+	}
+	if m := feed.Mode(); m != Merging {
+		t.Errorf("got mode %s under load, want merging", m)
+	}
+	if got := <-notify; got != 3+4+5 {
+		t.Errorf("got %v, want 12", got)
+	}
+
+	// receiver caught up
+	feed.Send(6)
+	if got := <-notify; got != 6 {
+		t.Errorf("got %v, want 6", got)
+	}
+	feed.Send(7) // routine passed revert
+	if m := feed.Mode(); m != LastWins {
+		t.Errorf("got mode %s after catch up, want last-wins", m)
+	}
+	<-notify
+}
+
+func TestUnsubscribeWhere(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	tenantA := map[chan<- interface{}]bool{}
+	for i := 0; i < 3; i++ {
+		c := make(chan interface{})
+		tenantA[c] = true
+		b.Subscribe(c)
+	}
+	b.Subscribe(make(chan interface{}))
+
+	n := b.UnsubscribeWhere(func(notify chan<- interface{}) bool {
+		return tenantA[notify]
+	})
+	if n != 3 {
+		t.Errorf("got %d removed, want 3", n)
+	}
+	if n := b.SubscriptionCount(); n != 1 {
+		t.Errorf("got %d subscriptions, want 1", n)
+	}
+}
+
+func TestLoadOrComputeOnce(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	var calls int32
+	release := make(chan struct{})
+	compute := func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "computed"
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 10)
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- b.LoadOrCompute(compute)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("got %d computations, want 1", n)
+	}
+	for v := range results {
+		if v != "computed" {
+			t.Errorf("got %v, want computed", v)
+		}
+	}
+}
+
+func TestLoadOrComputePanic(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("got recover %v, want boom", r)
+			}
+		}()
+		b.LoadOrCompute(func() interface{} { panic("boom") })
+	}()
+	if _, ok := b.Load(); ok {
+		t.Error("value set after compute panic")
+	}
+	if got := b.LoadOrCompute(func() interface{} { return 42 }); got != 42 {
+		t.Errorf("got %v after panic, want 42", got)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	b := Broadcast{IdleTimeout: 10 * time.Millisecond}
+	defer b.Close()
+
+	routines := runtime.NumGoroutine()
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	time.Sleep(50 * time.Millisecond)
+	if n := runtime.NumGoroutine(); n > routines {
+		t.Errorf("got %d goroutines after idle, want %d", n, routines)
+	}
+
+	// restart on update
+	b.Update("wake")
+	select {
+	case got := <-notify:
+		if got != "wake" {
+			t.Errorf("got %v, want wake", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no delivery after park")
+	}
+
+	// unsubscribe while parked
+	time.Sleep(50 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		b.UnsubscribeWait(notify)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("UnsubscribeWait blocked on parked subscription")
+	}
+}
+
+func TestIdleTimeoutLabels(t *testing.T) {
+	b := Broadcast{IdleTimeout: 50 * time.Millisecond}
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.SubscribeLabeled(notify, pprof.Labels("subscriber", "parking"))
+	labeled := func() bool {
+		var dump bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&dump, 1)
+		return strings.Contains(dump.String(), `"subscriber":"parking"`)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if labeled() {
+		t.Fatal("labeled routine present after idle")
+	}
+
+	b.Update("wake")
+	<-notify
+	if !labeled() {
+		t.Error("label absent after restart")
+	}
+}
+
+func TestIdleTimeoutRace(t *testing.T) {
+	b := Broadcast{IdleTimeout: time.Microsecond}
+	defer b.Close()
+
+	notify := make(chan interface{}, 1)
+	b.Subscribe(notify)
+	for i := 0; i < 1000; i++ {
+		b.Update(i)
+		if i%10 == 0 {
+			time.Sleep(time.Microsecond)
+		}
+	}
+	for v := range notify {
+		if v == 999 {
+			break
+		}
+	}
+}
+
+func TestSubscriberStats(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	fast := make(chan interface{}, 10)
+	slow := make(chan interface{})
+	b.Subscribe(fast)
+	b.Subscribe(slow)
+	b.UpdateWait(1, 10*time.Millisecond)
+	b.UpdateWait(2, 10*time.Millisecond)
+
+	stats := b.SubscriberStats()
+	if len(stats) != 2 {
+		t.Fatalf("got %d stats, want 2", len(stats))
+	}
+	for _, s := range stats {
+		switch s.Notify {
+		case fast:
+			if s.Delivered != 2 || s.Dropped != 0 || s.LastDelivery.IsZero() {
+				t.Errorf("fast subscriber got %+v", s)
+			}
+		case slow:
+			if s.Delivered != 0 || s.Dropped != 1 || !s.LastDelivery.IsZero() {
+				t.Errorf("slow subscriber got %+v", s)
+			}
+		default:
+			t.Errorf("unknown notify channel %v", s.Notify)
+		}
+	}
+}
+
+func TestSubscribeRetry(t *testing.T) {
+	clock := newFakeClock()
+	b := Broadcast{Clock: clock}
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.SubscribeRetry(notify, 3, time.Second)
+	defer func() {
+		b.UnsubscribeWait(notify)
+		close(notify)
+	}()
+
+	// receiver busy; Update may not wait on retries
+	start := time.Now()
+	b.Update(1)
+	b.Update(2)
+	<-clock.added // backoff of 1
+	b.Update(3)
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("updates took %s", d)
+	}
+	if v, _ := b.Load(); v != 3 {
+		t.Errorf("Load got %v, want 3", v)
+	}
+
+	// within retries
+	if got := <-notify; got != 1 {
+		t.Errorf("got %v, want 1", got)
+	}
+	if got := <-notify; got != 3 {
+		t.Errorf("got %v, want 3", got)
+	}
+
+	// retries exhausted
+	b.Update(4)
+	b.Update(5)
+	for i := 0; i < 3; i++ {
+		<-clock.added
+		clock.Advance(time.Second)
+	}
+	if got := <-notify; got != 5 {
+		t.Errorf("got %v after retries, want 5", got)
+	}
+	if n := b.Stats().Drops; n != 2 {
+		t.Errorf("got %d drops, want 2", n)
+	}
+}
+
+func TestCompareAndUpdate(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	if b.CompareAndUpdate(1, 2, nil) {
+		t.Error("non-nil old matched without value")
+	}
+	if !b.CompareAndUpdate(nil, 1, nil) {
+		t.Error("nil old did not match without value")
+	}
+	if b.CompareAndUpdate(0, 2, nil) {
+		t.Error("stale old matched")
+	}
+	if !b.CompareAndUpdate(1, 2, nil) {
+		t.Error("current old did not match")
+	}
+	if v, _ := b.Load(); v != 2 {
+		t.Errorf("got %v, want 2", v)
+	}
+
+	// non-comparable values never match with default eq
+	b.Update([]int{3})
+	if b.CompareAndUpdate([]int{3}, 4, nil) {
+		t.Error("slice matched with ==")
+	}
+}
+
+func TestCloseAndFlush(t *testing.T) {
+	var b Broadcast
+	b.Update("final")
+
+	ready := make(chan interface{}, 1)
+	b.Subscribe(ready)
+	if err := b.CloseAndFlush(context.Background()); err != nil {
+		t.Fatal("flush error:", err)
+	}
+	if got := <-ready; got != "final" {
+		t.Errorf("got %v, want final", got)
+	}
+	if err := b.Update("late"); err != ErrClosed {
+		t.Errorf("update after flush got error %v, want ErrClosed", err)
+	}
+	if err := b.CloseAndFlush(context.Background()); err != ErrClosed {
+		t.Errorf("second flush got error %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseAndFlushTimeout(t *testing.T) {
+	var b Broadcast
+	b.Update("final")
+	b.Subscribe(make(chan interface{}, 1))
+	b.Subscribe(make(chan interface{})) // no receiver
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := b.CloseAndFlush(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("got error %v, want 1 of 2 confirmed", err)
+	}
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions after flush, want 0", n)
+	}
+}
+
+func TestCloseAndFlushClose(t *testing.T) {
+	var b Broadcast
+	b.Update("final")
+	b.Subscribe(make(chan interface{})) // no receiver
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	flushed := make(chan error, 1)
+	go func() { flushed <- b.CloseAndFlush(ctx) }()
+	for b.Update("late") != ErrClosed {
+		time.Sleep(time.Millisecond) // await flush start
+	}
+
+	b.Close()
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions after Close, want 0", n)
+	}
+	if err := <-flushed; err == nil {
+		t.Error("flush without receiver got no error")
+	}
+}
+
+func TestUnsubscribeAllAndFlush(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+	b.Update("final")
+
+	persist := make(chan interface{}, 1)
+	ui := make(chan interface{})
+	b.SubscribePriority(ui, -1)
+	b.SubscribePriority(persist, 1)
+
+	done := make(chan int)
+	go func() {
+		<-ui
+		done <- len(persist)
+	}()
+	if err := b.UnsubscribeAllAndFlush(context.Background()); err != nil {
+		t.Fatal("flush error:", err)
+	}
+	if n := <-done; n != 1 {
+		t.Error("low priority got value before high priority")
+	}
+	if n := b.SubscriptionCount(); n != 0 {
+		t.Errorf("got %d subscriptions after flush, want 0", n)
+	}
+	if err := b.Update("next"); err != nil {
+		t.Errorf("update after flush got error %v", err)
+	}
+}
+
+func TestUnsubscribeAllAndFlushUpdate(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+	b.Update("old")
+
+	ui := make(chan interface{}, 1)
+	b.SubscribePriority(ui, -1)
+	b.SubscribeFunc(func(v interface{}) {
+		if v == "old" {
+			b.Update("new") // during flush, before confirmation
+		}
+	})
+
+	if err := b.UnsubscribeAllAndFlush(context.Background()); err != nil {
+		t.Fatal("flush error:", err)
+	}
+	select {
+	case v := <-ui:
+		if v != "new" {
+			t.Errorf("low priority got %v, want new", v)
+		}
+	default:
+		break // pending value discarded on termination
+	}
+}
+
+func TestUnsubscribeAllAndFlushSkip(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+	b.Update("final")
+
+	persist := make(chan interface{}, 1)
+	ui := make(chan interface{})
+	muted := make(chan interface{})
+	b.SubscribeCopy(persist, func(v interface{}) interface{} {
+		b.Unsubscribe(ui) // during flush, before confirmation
+		return v
+	})
+	b.SubscribePriority(ui, -1)
+	b.SubscribePriority(muted, -1)
+	b.Mute(muted)
+
+	if err := b.UnsubscribeAllAndFlush(context.Background()); err != nil {
+		t.Error("flush error on skipped subscriptions:", err)
+	}
+	if got := <-persist; got != "final" {
+		t.Errorf("got %v, want final", got)
+	}
+}
+
+func TestOverloaded(t *testing.T) {
+	b := Broadcast{OverloadThreshold: 3}
+	defer b.Close()
+	overloaded := b.Overloaded()
+
+	b.Subscribe(make(chan interface{})) // no receiver
+	for i := 0; i < 3; i++ {
+		b.Update(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-overloaded:
+		t.Error("signal before threshold reached")
+	default:
+	}
+
+	b.Update(3)
+	select {
+	case <-overloaded:
+	case <-time.After(time.Second):
+		t.Fatal("no signal on threshold")
+	}
+
+	// once per streak
+	for i := 4; i < 10; i++ {
+		b.Update(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-overloaded:
+		t.Error("repeated signal in same streak")
+	default:
+	}
+}
+
+func TestNewWindowFeed(t *testing.T) {
+	t.Parallel()
+	clock := newFakeClock()
+
+	notify := make(chan interface{}, 1) // fast receiver
+	feed := NewWindowFeed(notify, time.Second, clock)
+	defer close(feed)
+
+	feed <- 1
+	<-clock.added // window
+	feed <- 2
+	feed <- 3
+	select {
+	case v := <-notify:
+		t.Fatalf("got %v before window end", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(time.Second)
+	if got := <-notify; got != 3 {
+		t.Errorf("got %v, want 3", got)
+	}
+
+	feed <- 4
+	<-clock.added // next window
+	clock.Advance(time.Second)
+	if got := <-notify; got != 4 {
+		t.Errorf("got %v, want 4", got)
+	}
+}
+
+func TestSubscribeForward(t *testing.T) {
+	clock := newFakeClock()
+	b := Broadcast{Clock: clock}
+	defer b.Close()
+
+	var calls int32
+	var fail int32 = 1
+	br, cancel, err := b.SubscribeForward(func(interface{}) error {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&fail) != 0 {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	}, BreakerConfig{Failures: 2, Cooldown: time.Minute})
+	if err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	defer cancel()
+
+	b.UpdateWait(1, time.Second)
+	b.UpdateWait(2, time.Second)
+	if s := br.State(); s != BreakerOpen {
+		t.Errorf("got state %s after failures, want open", s)
+	}
+	b.UpdateWait(3, time.Second)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("got %d send calls, want 2 as open skips", n)
+	}
+
+	clock.Advance(time.Minute)
+	if s := br.State(); s != BreakerHalfOpen {
+		t.Errorf("got state %s after cooldown, want half-open", s)
+	}
+	atomic.StoreInt32(&fail, 0)
+	if n, _ := b.UpdateWait(4, time.Second); n != 1 {
+		t.Errorf("probe got %d confirmed, want 1", n)
+	}
+	if s := br.State(); s != BreakerClosed {
+		t.Errorf("got state %s after recovery, want closed", s)
+	}
+}
+
+func TestSubscribeFromSeq(t *testing.T) {
+	b := Broadcast{History: 3}
+	defer b.Close()
+	for i := 1; i <= 5; i++ {
+		b.Update(i)
+	}
+
+	notify := make(chan interface{})
+	gap, err := b.SubscribeFromSeq(notify, 2)
+	if err != nil || gap {
+		t.Fatalf("got gap %t and error %v, want neither", gap, err)
+	}
+	b.Update(6)
+	for want := 3; want <= 6; want++ {
+		if got := <-notify; got != want {
+			t.Errorf("got %v, want %d", got, want)
+		}
+	}
+
+	gap, _ = b.SubscribeFromSeq(make(chan interface{}), 1)
+	if !gap {
+		t.Error("no gap for versions beyond History")
+	}
+	gap, _ = b.SubscribeFromSeq(make(chan interface{}), 6)
+	if gap {
+		t.Error("gap when up to date")
+	}
+}
+
+func TestNotifyOnce(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+	b.Update("persistent")
+
+	notify := make(chan interface{}, 1)
+	b.Subscribe(notify)
+	b.NotifyOnce("reload requested")
+	if got := <-notify; got != "reload requested" {
+		t.Errorf("got %v, want reload requested", got)
+	}
+
+	if v, _ := b.Load(); v != "persistent" {
+		t.Errorf("Load got %v, want persistent", v)
+	}
+	if seq := b.Seq(); seq != 1 {
+		t.Errorf("got seq %d, want 1", seq)
+	}
+	if v, _ := b.SubscribeLatest(make(chan interface{})); v != "persistent" {
+		t.Errorf("late subscriber got %v, want persistent", v)
+	}
+}
+
+func TestCloseTree(t *testing.T) {
+	var root, mid, leaf Broadcast
+	slow := func(v interface{}) interface{} {
+		time.Sleep(time.Millisecond)
+		return v
+	}
+	root.Clone, mid.Clone = slow, slow
+	if _, err := root.SubscribeBroadcast(&mid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mid.SubscribeBroadcast(&leaf); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 100; i++ {
+		root.Update(i)
+	}
+	root.CloseTree()
+
+	for _, b := range []*Broadcast{&root, &mid, &leaf} {
+		if err := b.Update(0); err != ErrClosed {
+			t.Errorf("got Update error %v after CloseTree, want ErrClosed", err)
+		}
+		if v, _ := b.Load(); v != 100 {
+			t.Errorf("got %v after CloseTree, want 100", v)
+		}
+	}
+}
+
+func TestRecv(t *testing.T) {
+	notify := make(chan interface{}, 3)
+	notify <- 42
+	notify <- "mismatch"
+	close(notify)
+
+	if v, ok := Recv[int](notify); v != 42 || !ok {
+		t.Errorf("got (%d, %t), want (42, true)", v, ok)
+	}
+	if v, ok := Recv[int](notify); v != 0 || ok {
+		t.Errorf("got (%d, %t) on type mismatch, want (0, false)", v, ok)
+	}
+	if v, ok := Recv[int](notify); v != 0 || ok {
+		t.Errorf("got (%d, %t) on closed channel, want (0, false)", v, ok)
+	}
+}
+
+func TestAllCurrent(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+	if !b.AllCurrent() {
+		t.Error("not current without subscriptions")
+	}
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	_, err := b.SubscribeFunc(func(interface{}) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.AllCurrent() {
+		t.Error("not current without updates")
+	}
+
+	b.Update(1)
+	b.Update(2)
+	for i := 0; i < 10; i++ {
+		if b.AllCurrent() {
+			t.Fatal("current with a value pending")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	<-notify
+	deadline := time.Now().Add(time.Second)
+	for !b.AllCurrent() {
+		if time.Now().After(deadline) {
+			t.Fatal("not current after delivery")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGo(t *testing.T) {
+	var spawns int32
+	b := NewBroadcast(WithGo(func(f func()) {
+		atomic.AddInt32(&spawns, 1)
+		go f()
+	}))
+	defer b.Close()
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	if _, err := b.SubscribeFunc(func(interface{}) {}); err != nil {
+		t.Fatal(err)
+	}
+	b.Update("v")
+	if got := <-notify; got != "v" {
+		t.Errorf("got %v, want v", got)
+	}
+	if n := atomic.LoadInt32(&spawns); n != 2 {
+		t.Errorf("got %d spawns, want 2", n)
+	}
+}
+
+func TestWriteSSEResume(t *testing.T) {
+	b := Broadcast{History: 3}
+	defer b.Close()
+	for i := 1; i <= 5; i++ {
+		b.Update(i)
+	}
+
+	golden := []struct{ lastEventID, want string }{
+		{"", "id: 5\ndata: 5\n\n"},
+		{"3", "id: 4\ndata: 4\n\nid: 5\ndata: 5\n\n"},
+		{"5", ""},
+		{"1", "id: 5\nevent: gap\ndata: 5\n\n"},
+		{"99", "id: 5\nevent: gap\ndata: 5\n\n"},
+		{"bogus", "id: 5\nevent: gap\ndata: 5\n\n"},
+	}
+	for _, gold := range golden {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel() // backlog only
+		var buf bytes.Buffer
+		err := b.WriteSSE(ctx, &buf, gold.lastEventID)
+		if err != context.Canceled {
+			t.Errorf("%q: got error %v, want context.Canceled", gold.lastEventID, err)
+		}
+		if got := buf.String(); got != gold.want {
+			t.Errorf("%q: got %q, want %q", gold.lastEventID, got, gold.want)
+		}
+	}
+}
+
+func TestWriteSSELive(t *testing.T) {
+	var b Broadcast
+	r, w := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- b.WriteSSE(context.Background(), w, "")
+	}()
+
+	for b.SubscriptionCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Update("v")
+	buf := make([]byte, 64)
+	n, err := io.ReadAtLeast(r, buf, len("id: 1\ndata: \"v\"\n\n"))
+	if err != nil {
+		t.Fatal("read error:", err)
+	}
+	if got := string(buf[:n]); got != "id: 1\ndata: \"v\"\n\n" {
+		t.Errorf("got %q", got)
+	}
+	b.Close()
+	if err := <-done; err != nil {
+		t.Errorf("got error %v after Close, want nil", err)
+	}
+}
+
+func TestNewDistinctWindowFeed(t *testing.T) {
+	t.Parallel()
+	clock := newFakeClock()
+
+	notify := make(chan interface{}, 1) // fast receiver
+	eq := func(a, b interface{}) bool { return a == b }
+	feed := NewDistinctWindowFeed(notify, time.Second, eq, clock)
+	defer close(feed)
+
+	feed <- 1
+	<-clock.added // window
+	feed <- 2
+	clock.Advance(time.Second)
+	if got := <-notify; got != 2 {
+		t.Errorf("got %v, want 2", got)
+	}
+
+	// duplicate ends up in window
+	feed <- 3
+	<-clock.added // next window
+	feed <- 2
+	clock.Advance(time.Second)
+	select {
+	case v := <-notify:
+		t.Errorf("got duplicate %v", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	feed <- 4
+	<-clock.added // next window
+	clock.Advance(time.Second)
+	if got := <-notify; got != 4 {
+		t.Errorf("got %v, want 4", got)
+	}
+}
+
+func TestSubscribeChurn(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	for i := 0; i < 100; i++ {
+		stale := make(chan interface{})
+		b.Subscribe(stale)
+		b.Update(i) // pending on termination
+		b.UnsubscribeWait(stale)
+	}
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	select {
+	case v := <-notify:
+		t.Errorf("new subscription got stale %v", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+	b.Update("fresh")
+	if got := <-notify; got != "fresh" {
+		t.Errorf("got %v, want fresh", got)
+	}
+}
+
+func TestFeedFromBroadcast(t *testing.T) {
+	var b Broadcast
+	b.Update("v1")
+	notify, cancel := FeedFromBroadcast(&b)
+	if got := <-notify; got != "v1" {
+		t.Errorf("got %v, want current v1", got)
+	}
+	b.Update("v2")
+	if got := <-notify; got != "v2" {
+		t.Errorf("got %v, want v2", got)
+	}
+	cancel()
+	cancel() // idempotent
+	for v := range notify {
+		t.Errorf("got %v after cancel", v)
+	}
+
+	notify, _ = FeedFromBroadcast(&b)
+	<-notify // current
+	b.Close()
+	for v := range notify {
+		t.Errorf("got %v after Close", v)
+	}
+	notify, _ = FeedFromBroadcast(&b)
+	if _, ok := <-notify; ok {
+		t.Error("got value from closed Broadcast")
+	}
+}
+
+func TestBroadcastFromFeed(t *testing.T) {
+	update := make(chan interface{})
+	b := BroadcastFromFeed(update)
+	update <- 1
+	b.Wait(0)
+	if v, _ := b.Load(); v != 1 {
+		t.Errorf("got %v, want 1", v)
+	}
+	close(update)
+	b.Wait(1) // returns on Close
+	if err := b.Update(2); err != ErrClosed {
+		t.Errorf("got Update error %v after input closure, want ErrClosed", err)
+	}
+
+	update = make(chan interface{})
+	b = BroadcastFromFeed(update)
+	b.Close()
+	update <- "abandoned" // must not block
+	close(update)
+}
+
+func TestTextHandler(t *testing.T) {
+	var b Broadcast
+	h := b.TextHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d without value, want 404", rec.Code)
+	}
+
+	b.Update("v1")
+	b.Update(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if got, want := rec.Body.String(), "2020-01-02 03:04:05 +0000 UTC"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag != `"2"` {
+		t.Errorf("got ETag %s, want \"2\"", etag)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"1", `+etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("got status %d with %d bytes on matching ETag, want 304 without body", rec.Code, rec.Body.Len())
+	}
+
+	b.Update(42)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "42" {
+		t.Errorf("got status %d with %q on stale ETag, want 200 with 42", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d on POST, want 405", rec.Code)
+	}
+}
+
+func TestMaxSubscribers(t *testing.T) {
+	b := NewBroadcast(WithMaxSubscribers(2, RejectNew))
+	defer b.Close()
+	b.Subscribe(make(chan interface{}))
+	b.Subscribe(make(chan interface{}))
+	if err := b.Subscribe(make(chan interface{})); err != ErrFull {
+		t.Errorf("got error %v beyond limit, want ErrFull", err)
+	}
+	if n := b.SubscriptionCount(); n != 2 {
+		t.Errorf("got %d subscriptions, want 2", n)
+	}
+}
+
+func TestMaxSubscribersEvictOldest(t *testing.T) {
+	evicted := make(chan chan<- interface{}, 2)
+	b := NewBroadcast(WithMaxSubscribers(2, EvictOldest), WithOnEvict(func(notify chan<- interface{}) {
+		close(notify) // safe once evicted
+		evicted <- notify
+	}))
+	defer b.Close()
+
+	first := make(chan interface{})
+	second := make(chan interface{})
+	third := make(chan interface{})
+	b.SubscribePriority(first, -1) // age goes over priority
+	b.Subscribe(second)
+	if err := b.Subscribe(third); err != nil {
+		t.Fatal("subscribe with eviction:", err)
+	}
+	if got := <-evicted; got != (chan<- interface{})(first) {
+		t.Error("evicted other than the oldest subscription")
+	}
+	if _, ok := <-first; ok {
+		t.Error("evicted channel not closed")
+	}
+	if n := b.SubscriptionCount(); n != 2 {
+		t.Errorf("got %d subscriptions, want 2", n)
+	}
+
+	b.Update("v")
+	if got := <-third; got != "v" {
+		t.Errorf("newest got %v, want v", got)
+	}
+}
+
+func TestSubscribeCopy(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	mutator := make(chan interface{})
+	reader := make(chan interface{})
+	b.SubscribeCopy(mutator, func(v interface{}) interface{} {
+		return append([]int(nil), v.([]int)...)
+	})
+	b.Subscribe(reader)
+
+	shared := []int{1, 2}
+	b.Update(shared)
+	(<-mutator).([]int)[0] = 99
+	if got := (<-reader).([]int); &got[0] != &shared[0] {
+		t.Error("subscriber without copy got a copy")
+	}
+	if shared[0] != 1 {
+		t.Error("mutation of copy affects the current version")
+	}
+}
+
+func TestWaitIdle(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+	if err := b.WaitIdle(context.Background()); err != nil {
+		t.Fatal("idle without subscriptions got error:", err)
+	}
+
+	notify := make(chan interface{})
+	b.Subscribe(notify)
+	var calls int32
+	b.SubscribeFunc(func(interface{}) {
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&calls, 1)
+	})
+	b.Update(1)
+	b.Update(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.WaitIdle(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v with a value pending, want DeadlineExceeded", err)
+	}
+
+	go func() { <-notify }()
+	if err := b.WaitIdle(context.Background()); err != nil {
+		t.Fatal("got error:", err)
+	}
+	if !b.AllCurrent() {
+		t.Error("not current after WaitIdle")
+	}
+	if atomic.LoadInt32(&calls) == 0 {
+		t.Error("WaitIdle returned before callback")
+	}
+}
+
+func TestSubscribeLatestPause(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	other := make(chan interface{}, 2)
+	b.Subscribe(other)
+
+	b.Pause()
+	b.Update("held")
+	notify := make(chan interface{}, 2)
+	if current, _ := b.SubscribeLatest(notify); current != "held" {
+		t.Fatalf("got current %v, want held", current)
+	}
+	b.Resume()
+	if err := b.WaitIdle(context.Background()); err != nil {
+		t.Fatal("wait idle error:", err)
+	}
+	if got := <-other; got != "held" {
+		t.Errorf("other subscription got %v, want held", got)
+	}
+
+	b.Update("next")
+	if got := <-notify; got != "next" {
+		t.Errorf("got %v after current, want next", got)
+	}
+}
+
+func TestGoSubscribeContext(t *testing.T) {
+	var spawns int32
+	b := Broadcast{Go: func(f func()) {
+		atomic.AddInt32(&spawns, 1)
+		go f()
+	}}
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := b.SubscribeContext(ctx, make(chan interface{})); err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	if n := atomic.LoadInt32(&spawns); n != 2 {
+		t.Errorf("got %d routines started with Go, want feed and watch", n)
+	}
+
+	cancel()
+	for i := 0; b.SubscriptionCount() != 0; i++ {
+		if i > 100 {
+			t.Fatal("subscription not terminated after cancel")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWatchIntoValidate(t *testing.T) {
+	invalid := errors.New("invalid")
+	b := Broadcast{Validate: func(v interface{}) error {
+		if v == "" {
+			return invalid
+		}
+		return nil
+	}}
+	defer b.Close()
+
+	trigger := make(chan struct{})
+	defer close(trigger)
+	errs := WatchInto(&b, trigger, func() (interface{}, error) {
+		return "", nil
+	})
+	trigger <- struct{}{}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, invalid) {
+			t.Errorf("got error %v, want %v", err, invalid)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error from Validate")
+	}
+}
+
+// intSink passes each int to a channel.
+type intSink chan int
+
+func (s intSink) Deliver(v int) bool {
+	s <- v
+	return true
+}
+
+func TestSubscribeSinkType(t *testing.T) {
+	var b Broadcast
+	defer b.Close()
+
+	sink := make(intSink, 2)
+	if _, err := SubscribeSink[int](&b, sink); err != nil {
+		t.Fatal("subscribe error:", err)
+	}
+	b.UpdateWait("not an int", time.Second)
+	b.UpdateWait(nil, time.Second)
+	b.UpdateWait(42, time.Second)
+	if got := <-sink; got != 42 {
+		t.Errorf("got %d, want 42", got)
+	}
+	if len(sink) != 0 {
+		t.Error("sink got more than the int")
+	}
+}
@@ -0,0 +1,24 @@
+package latest
+
+// Logger receives diagnostics. The interface keeps the package free of any
+// logging dependency. Implementations must be safe for concurrent use.
+type Logger interface {
+	// Debugf logs lifecycle events, in the format of fmt.Printf.
+	Debugf(format string, args ...interface{})
+	// Warnf logs degradation, in the format of fmt.Printf.
+	Warnf(format string, args ...interface{})
+}
+
+// nopLogger is the default Logger.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+
+// log returns the Logger of b, if any, or a no-op otherwise.
+func (b *Broadcast) log() Logger {
+	if b.Logger == nil {
+		return nopLogger{}
+	}
+	return b.Logger
+}
@@ -0,0 +1,73 @@
+package latest
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+)
+
+// PublishExpvar exports b as an expvar.Var, which shows on the /debug/vars
+// endpoint. The JSON object has the current value, the number of
+// subscriptions, the number of updates, and the number of drops. Values which
+// fail to marshal are rendered with fmt instead. Like expvar.Publish, the name
+// must be unique, or PublishExpvar panics.
+func (b *Broadcast) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		v, seq, _, _ := b.State()
+		if _, err := json.Marshal(v); err != nil {
+			v = fmt.Sprint(v)
+		}
+
+		return map[string]interface{}{
+			"value":         v,
+			"subscriptions": b.SubscriptionCount(),
+			"updates":       seq,
+			"drops":         b.Stats().Drops,
+		}
+	}))
+}
+
+// Registerer accepts metrics which are sampled on collection. The interface
+// keeps the package free of any monitoring dependency. An adapter for
+// Prometheus can wrap prometheus.NewGaugeFunc and prometheus.NewCounterFunc
+// with a prometheus.Registerer.
+type Registerer interface {
+	// GaugeFunc registers a value which can go up and down.
+	GaugeFunc(name, help string, f func() float64) error
+	// CounterFunc registers a value which only goes up.
+	CounterFunc(name, help string, f func() float64) error
+}
+
+// RegisterMetrics exports b to reg, with namespace as the name prefix. The
+// metrics are the subscription count, the number of updates, the number of
+// drops, and the moment of the last update in Unix seconds. The error is from
+// reg, if any.
+func (b *Broadcast) RegisterMetrics(reg Registerer, namespace string) error {
+	prefix := namespace
+	if prefix != "" {
+		prefix += "_"
+	}
+
+	if err := reg.GaugeFunc(prefix+"subscriptions", "Number of subscriptions.", func() float64 {
+		return float64(b.SubscriptionCount())
+	}); err != nil {
+		return err
+	}
+	if err := reg.CounterFunc(prefix+"updates_total", "Number of versions set.", func() float64 {
+		return float64(b.Seq())
+	}); err != nil {
+		return err
+	}
+	if err := reg.CounterFunc(prefix+"drops_total", "Number of values discarded.", func() float64 {
+		return float64(b.Stats().Drops)
+	}); err != nil {
+		return err
+	}
+	return reg.GaugeFunc(prefix+"last_update_timestamp_seconds", "Moment of the latest update.", func() float64 {
+		_, _, at, ok := b.State()
+		if !ok {
+			return 0
+		}
+		return float64(at.UnixNano()) / 1e9
+	})
+}
@@ -0,0 +1,89 @@
+package latest
+
+import "time"
+
+// Option configures a Broadcast.
+type Option func(*Broadcast)
+
+// NewBroadcast returns a new Broadcast with the options applied in order.
+// The zero value of Broadcast is ready to use as an alternative.
+func NewBroadcast(opts ...Option) *Broadcast {
+	b := new(Broadcast)
+	for _, o := range opts {
+		o(b)
+	}
+	return b
+}
+
+// WithSendTimeout sets Broadcast.SendTimeout.
+func WithSendTimeout(d time.Duration) Option {
+	return func(b *Broadcast) { b.SendTimeout = d }
+}
+
+// WithDeliveryJitter sets Broadcast.DeliveryJitter.
+func WithDeliveryJitter(max time.Duration) Option {
+	return func(b *Broadcast) { b.DeliveryJitter = max }
+}
+
+// WithMaxAge sets Broadcast.MaxAge.
+func WithMaxAge(d time.Duration) Option {
+	return func(b *Broadcast) { b.MaxAge = d }
+}
+
+// WithClone sets Broadcast.Clone.
+func WithClone(f func(interface{}) interface{}) Option {
+	return func(b *Broadcast) { b.Clone = f }
+}
+
+// WithWorkers sets Broadcast.Workers.
+func WithWorkers(n int) Option {
+	return func(b *Broadcast) { b.Workers = n }
+}
+
+// WithHistory sets Broadcast.History.
+func WithHistory(n int) Option {
+	return func(b *Broadcast) { b.History = n }
+}
+
+// WithIdleTimeout sets Broadcast.IdleTimeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(b *Broadcast) { b.IdleTimeout = d }
+}
+
+// WithOverloadThreshold sets Broadcast.OverloadThreshold.
+func WithOverloadThreshold(n int) Option {
+	return func(b *Broadcast) { b.OverloadThreshold = n }
+}
+
+// WithLogger sets Broadcast.Logger.
+func WithLogger(l Logger) Option {
+	return func(b *Broadcast) { b.Logger = l }
+}
+
+// WithMaxSubscribers sets Broadcast.MaxSubscribers and Broadcast.LimitPolicy.
+func WithMaxSubscribers(n int, policy LimitPolicy) Option {
+	return func(b *Broadcast) {
+		b.MaxSubscribers = n
+		b.LimitPolicy = policy
+	}
+}
+
+// WithOnEvict sets Broadcast.OnEvict.
+func WithOnEvict(f func(notify chan<- interface{})) Option {
+	return func(b *Broadcast) { b.OnEvict = f }
+}
+
+// WithGo sets Broadcast.Go.
+func WithGo(f func(f func())) Option {
+	return func(b *Broadcast) { b.Go = f }
+}
+
+// WithClock sets Broadcast.Clock.
+func WithClock(c Clock) Option {
+	return func(b *Broadcast) { b.Clock = c }
+}
+
+// WithValidate sets Broadcast.Validate.
+func WithValidate(f func(interface{}) error) Option {
+	return func(b *Broadcast) { b.Validate = f }
+}
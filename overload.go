@@ -0,0 +1,46 @@
+package latest
+
+import "sync/atomic"
+
+// defaultOverloadThreshold applies when OverloadThreshold is zero.
+const defaultOverloadThreshold = 8
+
+// Overloaded returns a channel which receives when any of the subscriptions
+// gets overloaded, i.e., when OverloadThreshold values in a row got discarded
+// on coalescing, without any delivery in between. A subscription signals once
+// per streak; it recovers on the next delivery. Signals coalesce, such that
+// adaptive producers can reduce their update frequency on receive. Detection
+// is off until the first invocation. All invocations return the same channel.
+// The channel is never closed.
+func (b *Broadcast) Overloaded() <-chan struct{} {
+	b.Lock()
+	defer b.Unlock()
+
+	c, _ := b.overload.c.Load().(chan struct{})
+	if c == nil {
+		c = make(chan struct{}, 1)
+		b.overload.c.Store(c)
+	}
+	return c
+}
+
+// overloadSignal is the Overloaded destination.
+type overloadSignal struct {
+	c atomic.Value // chan struct{}, if any
+}
+
+// emit signals, if enabled and if no signal is pending.
+func (o *overloadSignal) emit() {
+	if o == nil {
+		return
+	}
+	c, _ := o.c.Load().(chan struct{})
+	if c == nil {
+		return
+	}
+	select {
+	case c <- struct{}{}:
+	default:
+		break // signal pending
+	}
+}
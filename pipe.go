@@ -0,0 +1,68 @@
+package latest
+
+// Pipeline is a chain of transforms on a channel. All stages run in the same
+// routine as the delivery. Coalescing applies at the output only.
+type Pipeline struct {
+	in     <-chan interface{}
+	stages []func(interface{}) (interface{}, bool)
+}
+
+// Pipe returns a Pipeline without transforms.
+func Pipe(in <-chan interface{}) Pipeline {
+	return Pipeline{in: in}
+}
+
+// with returns a copy of p with stage appended.
+func (p Pipeline) with(stage func(interface{}) (interface{}, bool)) Pipeline {
+	stages := make([]func(interface{}) (interface{}, bool), len(p.stages), len(p.stages)+1)
+	copy(stages, p.stages)
+	return Pipeline{in: p.in, stages: append(stages, stage)}
+}
+
+// Map returns p with f applied to each value.
+func (p Pipeline) Map(f func(interface{}) interface{}) Pipeline {
+	return p.with(func(v interface{}) (interface{}, bool) {
+		return f(v), true
+	})
+}
+
+// Filter returns p with values omitted when pred is false.
+func (p Pipeline) Filter(pred func(interface{}) bool) Pipeline {
+	return p.with(func(v interface{}) (interface{}, bool) {
+		return v, pred(v)
+	})
+}
+
+// To starts delivery to notify. Slow receivers get the latest output only,
+// as with NewFeed. Delivery stops once the input is closed.
+func (p Pipeline) To(notify chan<- interface{}) {
+	go func() {
+		var latest interface{}
+		var out chan<- interface{} // nil blocks
+		for {
+			select {
+			case v, ok := <-p.in:
+				if !ok {
+					return
+				}
+				if v, ok = p.apply(v); ok {
+					latest, out = v, notify
+				}
+			case out <- latest:
+				latest, out = nil, nil
+			}
+		}
+	}()
+}
+
+// apply runs the stages on v.
+func (p Pipeline) apply(v interface{}) (interface{}, bool) {
+	for _, stage := range p.stages {
+		var ok bool
+		v, ok = stage(v)
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
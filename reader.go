@@ -0,0 +1,86 @@
+package latest
+
+import (
+	"io"
+	"sync"
+)
+
+// Reader returns a stream of the versions, as encoded by enc, starting with
+// the current version, if any. Each Read blocks until a version is available.
+// A version may span multiple reads, and versions which arrive while one is
+// in progress coalesce, as with NewFeed. The stream ends with io.EOF on Close
+// of either the reader or b. The error from enc is passed on by Read.
+func (b *Broadcast) Reader(enc func(interface{}) ([]byte, error)) io.ReadCloser {
+	r := &reader{
+		b:      b,
+		notify: make(chan interface{}),
+		closed: make(chan struct{}),
+		enc:    enc,
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	s, err := b.subscribe(r.notify, 0)
+	if err != nil {
+		done := make(chan struct{})
+		close(done)
+		r.done = done // EOF
+		return r
+	}
+	s.spawn(s.run)
+	r.done = s.done
+	r.current, r.hasCurrent = b.latest, b.hasLatest
+	return r
+}
+
+// reader is the io.ReadCloser of Broadcast.Reader.
+type reader struct {
+	b      *Broadcast
+	notify chan interface{}
+	done   <-chan struct{} // subscription termination
+	enc    func(interface{}) ([]byte, error)
+
+	closeOnce sync.Once
+	closed    chan struct{} // Close signal
+
+	current    interface{} // first version
+	hasCurrent bool        // whether current is pending
+	buf        []byte      // unread part of an encoded version
+}
+
+// Read implements io.Reader.
+func (r *reader) Read(p []byte) (n int, err error) {
+	for len(r.buf) == 0 {
+		var v interface{}
+		if r.hasCurrent {
+			v, r.hasCurrent = r.current, false
+			r.current = nil
+		} else {
+			select {
+			case v = <-r.notify:
+			case <-r.done:
+				return 0, io.EOF
+			case <-r.closed:
+				return 0, io.EOF
+			}
+		}
+		r.buf, err = r.enc(v)
+		if err != nil {
+			r.buf = nil
+			return 0, err
+		}
+	}
+
+	n = copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close implements io.Closer.
+func (r *reader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		r.b.Unsubscribe(r.notify)
+	})
+	return nil
+}
@@ -0,0 +1,178 @@
+package latest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Relay writes each value received from notify to w, as encoded by enc, until
+// notify is closed. Each message is framed with a 4-byte, big-endian length
+// prefix, as read by ConsumeRelay. Values pile up in the feed of notify while
+// a write is in progress, such that slow connections get the latest only, as
+// with NewFeed. The error is from either enc or w, with nil for closure of
+// notify.
+func Relay(w io.Writer, notify <-chan interface{}, enc func(interface{}) ([]byte, error)) error {
+	var buf []byte
+	for v := range notify {
+		var err error
+		buf, err = writeFrame(w, buf, v, enc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSONL writes each value received from notify to w as a line of JSON,
+// until notify is closed. W is flushed after each line when it has a Flush
+// method, as with http.Flusher and bufio.Writer. Values pile up in the feed of
+// notify while a write is in progress, such that slow writers get the latest
+// only. The error is from either encoding, or w, or flush, with nil for closure
+// of notify.
+func WriteJSONL(w io.Writer, notify <-chan interface{}) error {
+	enc := json.NewEncoder(w)
+	for v := range notify {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		switch f := w.(type) {
+		case interface{ Flush() error }:
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		case interface{ Flush() }:
+			f.Flush()
+		}
+	}
+	return nil
+}
+
+// SubscribeRelay is like Relay, yet it runs on a subscription of b, starting
+// with the current version. The current version, if any, is encoded once in
+// advance, such that values which never encode are rejected with an error
+// from enc before any stream starts. Errs receives the error from enc or w, if
+// any, after which the subscription terminates. Errs is closed once the
+// subscription terminated, i.e., on an error, on cancel, or on Close of b.
+func (b *Broadcast) SubscribeRelay(w io.Writer, enc func(interface{}) ([]byte, error)) (errs <-chan error, cancel func(), err error) {
+	if current, ok := b.Load(); ok {
+		if _, err := enc(current); err != nil {
+			return nil, func() {}, err
+		}
+	}
+
+	c := make(chan error, 1)
+	fail := make(chan struct{}) // closed on error
+	var buf []byte
+	var failed bool
+	b.Lock()
+	s, err := b.addCallback(func(v interface{}) bool {
+		if failed {
+			return false
+		}
+		var err error
+		buf, err = writeFrame(w, buf, v, enc)
+		if err != nil {
+			failed = true
+			c <- err
+			close(fail)
+			return false
+		}
+		return true
+	}, true)
+	if err != nil {
+		b.Unlock()
+		return nil, func() {}, err
+	}
+	s.spawn(func() {
+		select {
+		case <-fail:
+			b.Unsubscribe(s.notify)
+			<-s.exited
+		case <-s.exited:
+			break // terminated otherwise
+		}
+		close(c) // no more errors
+	})
+	b.Unlock()
+	return c, func() { b.Unsubscribe(s.notify) }, nil
+}
+
+// maxFrameSize is the upper boundary for relay messages.
+const maxFrameSize = 1<<32 - 1
+
+// writeFrame sends v, as encoded by enc, with a length prefix to w. Buf is
+// for reuse.
+func writeFrame(w io.Writer, buf []byte, v interface{}, enc func(interface{}) ([]byte, error)) ([]byte, error) {
+	data, err := enc(v)
+	if err != nil {
+		return buf, err
+	}
+	if uint64(len(data)) > maxFrameSize {
+		return buf, fmt.Errorf("latest: relay frame of %d bytes exceeds limit", len(data))
+	}
+
+	buf = append(buf[:0], 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	buf = append(buf, data...)
+	_, err = w.Write(buf)
+	return buf, err
+}
+
+// ConsumeRelay mirrors the messages from a Relay on r with a Broadcast. Each
+// frame read is decoded with dec, and then passed to Update. The Broadcast is
+// closed once r ends, or on a malformed frame, or on an error from either r or
+// dec. Stop closes the Broadcast too. Note that a pending read on r is not
+// interrupted by stop; close r to do so.
+//
+// Errs receives the cause of termination, if any, after which it is closed.
+// The end of r on a frame boundary is no error, and neither is stop. Frames
+// cut short get io.ErrUnexpectedEOF. Errors from r and dec pass as is.
+func ConsumeRelay(r io.Reader, dec func([]byte) (interface{}, error)) (mirror *Broadcast, stop func(), errs <-chan error) {
+	b := new(Broadcast)
+	c := make(chan error, 1)
+	go func() {
+		defer close(c)
+
+		err := consumeFrames(b, r, dec)
+		b.Close()
+		if err != nil {
+			c <- err
+		}
+	}()
+	return b, b.Close, c
+}
+
+// consumeFrames implements ConsumeRelay.
+func consumeFrames(b *Broadcast, r io.Reader, dec func([]byte) (interface{}, error)) error {
+	var head [4]byte
+	var buf bytes.Buffer
+	for {
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			if err == io.EOF {
+				return nil // on frame boundary
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(head[:]))
+
+		// grow on arrival, as the size is not trusted
+		buf.Reset()
+		n, err := buf.ReadFrom(io.LimitReader(r, size))
+		if err != nil {
+			return err
+		}
+		if n != size {
+			return io.ErrUnexpectedEOF // partial frame
+		}
+		v, err := dec(buf.Bytes())
+		if err != nil {
+			return err // malformed frame
+		}
+		if b.Update(v) == ErrClosed {
+			return nil // stopped
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package latest
+
+import "sync"
+
+// Signal notifies waiters of change, without any value. Triggers coalesce,
+// i.e., each Wait returns once per batch of Trigger invocations. The zero
+// value is ready to use. Multiple goroutines may invoke methods on a Signal
+// simultaneously.
+type Signal struct {
+	mutex sync.Mutex
+	c     chan struct{} // closed on Trigger, if any
+}
+
+// Trigger wakes all pending Wait invocations.
+func (s *Signal) Trigger() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.c != nil {
+		close(s.c)
+		s.c = nil
+	}
+}
+
+// Wait blocks until the next Trigger.
+func (s *Signal) Wait() {
+	<-s.C()
+}
+
+// C returns a channel which is closed on the next Trigger, for use in select
+// statements. Triggers prior to C are not observed.
+func (s *Signal) C() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.c == nil {
+		s.c = make(chan struct{})
+	}
+	return s.c
+}
@@ -0,0 +1,121 @@
+package latest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteSSE streams b to w in the text/event-stream format of Server-Sent
+// Events, until ctx is done or b is closed. Each event has a version as JSON
+// data, with its sequence number, as by Seq, as the event ID. The stream
+// starts with the current version, if any. Slow writers get the latest version
+// only, as with NewFeed. W is flushed after each event when it has a Flush
+// method, as with WriteJSONL.
+//
+// The event ID serves as a resume token. Reconnecting clients pass the last ID
+// they received in the Last-Event-ID header, which goes in lastEventID, with
+// the empty string for none. The stream then resumes with the versions after
+// lastEventID, as retained per History. When the History does not go back far
+// enough, or when lastEventID is not an ID of b, then the stream starts with
+// the current version as an event of type "gap" instead, such that clients can
+// tell that they missed versions.
+//
+// The error is from either encoding or w, or ctx.Err(), with nil on Close.
+func (b *Broadcast) WriteSSE(ctx context.Context, w io.Writer, lastEventID string) error {
+	notify := make(chan interface{}) // wakeup only
+
+	b.Lock()
+	s, err := b.subscribe(notify, 0)
+	if err != nil {
+		b.Unlock()
+		return err
+	}
+	s.spawn(s.run)
+	backlog, gap := b.resumeFrom(lastEventID)
+	b.Unlock()
+	defer b.Unsubscribe(notify)
+
+	var last uint64 // sequence number written
+	for i, e := range backlog {
+		if err := writeEvent(w, e, gap && i == 0); err != nil {
+			return err
+		}
+		last = e.seq
+	}
+
+	for {
+		select {
+		case <-notify:
+			b.RLock()
+			e := version{v: b.latest, seq: b.seq}
+			b.RUnlock()
+			if e.seq <= last {
+				continue // written already
+			}
+			if err := writeEvent(w, e, false); err != nil {
+				return err
+			}
+			last = e.seq
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// resumeFrom returns the versions after lastEventID, as retained per History,
+// or the current version, with gap set when versions are missing. The caller
+// must hold the lock.
+func (b *Broadcast) resumeFrom(lastEventID string) (backlog []version, gap bool) {
+	if !b.hasLatest {
+		return nil, false
+	}
+	current := version{v: b.latest, seq: b.seq, at: b.at}
+	if lastEventID == "" {
+		return []version{current}, false
+	}
+	since, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil || since > b.seq {
+		return []version{current}, true // foreign token
+	}
+
+	for _, e := range b.history() {
+		if e.seq > since {
+			backlog = append(backlog, e)
+		}
+	}
+	switch {
+	case since == b.seq:
+		return nil, false // up to date
+	case len(backlog) == 0 || backlog[0].seq > since+1:
+		return []version{current}, true
+	}
+	return backlog, false
+}
+
+// writeEvent writes e as a Server-Sent Event, with event type "gap" on gap.
+func writeEvent(w io.Writer, e version, gap bool) error {
+	data, err := json.Marshal(e.v)
+	if err != nil {
+		return err
+	}
+	if gap {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: gap\ndata: %s\n\n", e.seq, data)
+	} else {
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.seq, data)
+	}
+	if err != nil {
+		return err
+	}
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
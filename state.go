@@ -0,0 +1,82 @@
+package latest
+
+import (
+	"errors"
+	"time"
+)
+
+// State is the serializable part of a Broadcast, for transfer to another
+// process. Subscriptions are not included, as channels can't cross process
+// boundaries; clients reconnect instead.
+type State struct {
+	Value    interface{} // current version
+	HasValue bool        // whether Value is set
+	Seq      uint64      // number of versions set
+	At       time.Time   // moment of Value set
+
+	SendTimeout    time.Duration
+	DeliveryJitter time.Duration
+	MaxAge         time.Duration
+	History        int
+}
+
+// ExportState returns a snapshot for RestoreState.
+func (b *Broadcast) ExportState() State {
+	b.RLock()
+	defer b.RUnlock()
+
+	return State{
+		Value:          b.latest,
+		HasValue:       b.hasLatest,
+		Seq:            b.seq,
+		At:             b.at,
+		SendTimeout:    b.SendTimeout,
+		DeliveryJitter: b.DeliveryJitter,
+		MaxAge:         b.MaxAge,
+		History:        b.History,
+	}
+}
+
+// ErrInUse signals a RestoreState on a Broadcast which got updates already.
+var ErrInUse = errors.New("latest: broadcast has versions")
+
+// RestoreState applies a snapshot from ExportState. The sequence continues
+// where the export left off, so it requires a Broadcast without any Update
+// yet, with ErrInUse otherwise. Subscriptions present, if any, receive the
+// restored value, as with Update. Validate does not apply. The error is
+// ErrClosed after Close.
+func (b *Broadcast) RestoreState(st State) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if b.seq != 0 {
+		return ErrInUse
+	}
+
+	b.SendTimeout = st.SendTimeout
+	b.DeliveryJitter = st.DeliveryJitter
+	b.MaxAge = st.MaxAge
+	b.History = st.History
+	if !st.HasValue {
+		return nil
+	}
+
+	b.latest, b.hasLatest = st.Value, true
+	b.seq = st.Seq
+	b.at = st.At
+	b.retain()
+	if b.cond != nil {
+		b.cond.Broadcast()
+	}
+	if b.paused {
+		b.held = true
+		return nil
+	}
+	b.each(func(s *subscription) {
+		b.send(s, message{v: b.latest, at: b.at})
+	})
+	return nil
+}
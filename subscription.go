@@ -0,0 +1,423 @@
+package latest
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// subscription is a Broadcast registration.
+type subscription struct {
+	drops        uint64 // number of values discarded; atomic access only
+	delivered    uint64 // number of values passed; atomic access only
+	lastDelivery int64  // Unix nanoseconds of last pass; atomic access only
+	queued       uint64 // number of inputs sent to feed; atomic access only
+	taken        uint64 // number of inputs received from feed; atomic access only
+	streak       int32  // coalescings since delivery; atomic access only
+	holding      int32  // whether the routine has a value pending; atomic access only
+
+	notify chan<- interface{} // receiver
+	feed   chan message       // routine input
+	done   chan struct{}      // closed on termination
+	exited chan struct{}      // closed on routine return
+	ready  chan struct{}      // closed on routine start, if any
+
+	priority int           // fan-out order
+	join     uint64        // subscription number, for order of age
+	group    string        // SubscribeGroup, if any
+	jitter   time.Duration // maximum delivery delay
+	maxAge   time.Duration // expiry of undelivered values
+	clock    Clock         // time source
+	spawn    func(func())  // routine start
+	start    func()        // routine entry point, for restarts after parking
+	idle     time.Duration // parking threshold, if any
+	retries  int           // SubscribeRetry attempts, if any
+	backoff  time.Duration // SubscribeRetry delay per attempt
+
+	clone func(interface{}) interface{} // optional copy
+	equal func(a, b interface{}) bool   // SubscribeDistinct, if any
+
+	muted bool   // guarded by the Broadcast lock
+	seen  uint64 // sequence number handed out by SubscribeLatest, if any; guarded by the Broadcast lock
+
+	// SubscribeDistinct state, owned by the routine
+	last    interface{} // latest delivery, before clone
+	hasLast bool        // whether last is set
+
+	park     sync.Mutex // guards parking, when idle is set
+	parked   bool       // whether the routine exited on idle
+	inflight int        // number of sends in progress
+	stopped  bool       // whether stop happened
+
+	events     *eventLog       // debug output
+	overload   *overloadSignal // Overloaded output
+	overloadAt int32           // streak which signals overload
+	caughtUp   *idleSignal     // WaitIdle output
+
+	cb    *callback  // SubscribeFunc, if any
+	child *Broadcast // SubscribeBroadcast target, if any
+
+	replay []interface{} // SubscribeFromSeq backlog; owned by the routine
+}
+
+// message is a subscription input.
+type message struct {
+	v  interface{} // update
+	at time.Time   // moment of update
+
+	// Ack, when set, receives whether v was delivered without delay.
+	// The channel must have buffer space for one element.
+	ack chan<- bool
+	// Confirm, when set, receives whether v was delivered eventually, as
+	// opposed to discarded. The channel must have buffer space.
+	confirm chan<- bool
+
+	clear bool // discards any pending value instead
+}
+
+// feedPool recycles the input channels of terminated subscriptions, which
+// saves an allocation per subscription on heavy churn. Unbuffered channels
+// which are never closed have no state to reset.
+var feedPool = sync.Pool{
+	New: func() interface{} { return make(chan message) },
+}
+
+func newSubscription(notify chan<- interface{}) *subscription {
+	s := &subscription{
+		notify: notify,
+		feed:   feedPool.Get().(chan message),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+		clock:  SystemClock{},
+		spawn:  goStatement,
+	}
+	s.start = s.run
+	return s
+}
+
+// goStatement is the default spawn of a subscription.
+func goStatement(f func()) { go f() }
+
+// settle resolves any confirmation pending on m.
+func (m *message) settle(delivered bool) {
+	if m.confirm != nil {
+		m.confirm <- delivered
+		m.confirm = nil
+	}
+}
+
+// insertByPriority adds s to list, which is in order of priority, after any
+// subscriptions of equal priority.
+func insertByPriority(list []*subscription, s *subscription) []*subscription {
+	i := len(list)
+	for i > 0 && list[i-1].priority < s.priority {
+		i--
+	}
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = s
+	return list
+}
+
+// without deletes s from list, with order preserved.
+func without(list []*subscription, s *subscription) []*subscription {
+	for i, o := range list {
+		if o == s {
+			copy(list[i:], list[i+1:])
+			list[len(list)-1] = nil // release
+			return list[:len(list)-1]
+		}
+	}
+	return list
+}
+
+// stop terminates s. The Broadcast lock must be held.
+func (s *subscription) stop() {
+	close(s.done)
+	if s.idle > 0 {
+		s.park.Lock()
+		s.stopped = true
+		if s.parked {
+			close(s.exited) // no routine
+			feedPool.Put(s.feed)
+		}
+		s.park.Unlock()
+	}
+	s.events.emit(EventClosed, s.notify)
+	if s.cb != nil {
+		s.cb.stop()
+	}
+	s.caughtUp.emit() // no longer pending
+}
+
+// delivery registers m passed, with raw as its value before clone.
+func (s *subscription) delivery(m *message, raw interface{}) {
+	s.last, s.hasLast = raw, true
+	s.countDelivery()
+	m.settle(true)
+	s.events.emit(EventDelivered, s.notify)
+}
+
+// isCurrent returns whether s has no value pending. The caller must hold the
+// Broadcast lock, such that no send is in progress.
+func (s *subscription) isCurrent() bool {
+	if s.cb != nil {
+		return s.cb.idle()
+	}
+	// holding is stored before taken
+	return atomic.LoadUint64(&s.taken) == atomic.LoadUint64(&s.queued) &&
+		atomic.LoadInt32(&s.holding) == 0
+}
+
+// coalesced registers a pending value replaced.
+func (s *subscription) coalesced() {
+	atomic.AddUint64(&s.drops, 1)
+	s.events.emit(EventCoalesced, s.notify)
+	if atomic.AddInt32(&s.streak, 1) == s.overloadAt {
+		s.overload.emit()
+	}
+}
+
+// countDelivery registers a value passed.
+func (s *subscription) countDelivery() {
+	atomic.StoreInt32(&s.streak, 0)
+	atomic.AddUint64(&s.delivered, 1)
+	atomic.StoreInt64(&s.lastDelivery, s.clock.Now().UnixNano())
+}
+
+// wake restarts the routine when parked, and it registers a send in progress
+// until sent is called.
+func (s *subscription) wake() {
+	s.park.Lock()
+	if s.parked {
+		s.parked = false
+		s.spawn(s.start)
+	}
+	s.inflight++
+	s.park.Unlock()
+}
+
+// sent ends a send from wake.
+func (s *subscription) sent() {
+	s.park.Lock()
+	s.inflight--
+	s.park.Unlock()
+}
+
+// tryPark returns whether the routine may exit for wake to restart it.
+func (s *subscription) tryPark() bool {
+	s.park.Lock()
+	defer s.park.Unlock()
+
+	if s.inflight != 0 || s.stopped {
+		return false // receive pending first
+	}
+	s.parked = true
+	return true
+}
+
+// run implements the feed routine, like NewFeed does.
+func (s *subscription) run() {
+	var parked bool
+	defer func() {
+		if !parked {
+			close(s.exited)
+			// senders are gone with the termination
+			feedPool.Put(s.feed)
+		}
+	}()
+	if s.ready != nil {
+		close(s.ready)
+		s.ready = nil
+	}
+
+	var m message               // latest input
+	var pending bool            // whether m is undelivered
+	var delay <-chan time.Time  // jitter in progress
+	var expire <-chan time.Time // maximum age of m
+	var idle <-chan time.Time   // parking timer
+	var next message            // input held back on retry, if any
+	var hasNext bool            // whether next is set
+	var retry <-chan time.Time  // retry backoff in progress
+	var attempts int            // retries of m since next arrived
+	defer func() {
+		m.settle(false)
+		next.settle(false)
+	}()
+
+	var raw interface{} // m.v before clone
+	var received bool   // whether taken is behind
+	wasCurrent := true  // isCurrent as of last iteration
+
+	// promote replaces m with next.
+	promote := func() {
+		m, raw = next, next.v
+		next, hasNext = message{}, false
+		retry = nil
+		if s.clone != nil {
+			m.v = s.clone(m.v)
+		}
+		expire = nil
+		if s.maxAge > 0 {
+			expire = s.clock.After(s.maxAge - s.clock.Now().Sub(m.at))
+		}
+		pending = true
+	}
+
+	for {
+		// publish state for isCurrent, with holding before taken
+		current := !pending && len(s.replay) == 0
+		if current {
+			atomic.StoreInt32(&s.holding, 0)
+		} else {
+			atomic.StoreInt32(&s.holding, 1)
+		}
+		if received {
+			atomic.AddUint64(&s.taken, 1)
+		}
+		if current && (received || !wasCurrent) {
+			s.caughtUp.emit()
+		}
+		received, wasCurrent = false, current
+
+		if pending && m.ack != nil {
+			if s.jitter > 0 || len(s.replay) != 0 {
+				m.ack <- false // no direct delivery
+			} else {
+				// tracked delivery attempt
+				select {
+				case s.notify <- m.v:
+					m.ack <- true
+					pending = false
+					s.delivery(&m, raw)
+				default:
+					m.ack <- false
+				}
+			}
+			m.ack = nil
+			continue
+		}
+
+		var notify chan<- interface{} // nil blocks
+		out := m.v
+		switch {
+		case len(s.replay) != 0:
+			notify, out = s.notify, s.replay[0]
+			if s.clone != nil {
+				out = s.clone(out)
+			}
+		case pending && delay == nil:
+			notify = s.notify
+		}
+		if !pending && len(s.replay) == 0 && s.idle > 0 && idle == nil {
+			idle = s.clock.After(s.idle)
+		}
+		select {
+		case in := <-s.feed:
+			idle = nil
+			received = true
+			if in.clear {
+				m.settle(false)
+				next.settle(false)
+				m, next = message{}, message{}
+				delay, expire, retry = nil, nil, nil
+				pending, hasNext = false, false
+				break
+			}
+			if s.equal != nil && s.hasLast && s.equal(s.last, in.v) {
+				// receiver has the value already
+				if pending {
+					atomic.AddUint64(&s.drops, 1)
+					m.settle(false)
+					m = message{}
+					delay, expire = nil, nil
+					pending = false
+				}
+				if hasNext {
+					atomic.AddUint64(&s.drops, 1)
+					next.settle(false)
+					next, hasNext = message{}, false
+					retry = nil
+				}
+				if in.ack != nil {
+					in.ack <- false
+				}
+				in.settle(false)
+				break
+			}
+			if pending && delay == nil && s.retries != 0 {
+				// hold the newer update back for retries of m
+				if in.ack != nil {
+					in.ack <- false // no direct delivery
+					in.ack = nil
+				}
+				if hasNext {
+					s.coalesced()
+					next.settle(false)
+				} else {
+					attempts = 0
+					retry = s.clock.After(s.backoff)
+				}
+				next, hasNext = in, true
+				break
+			}
+			if pending {
+				s.coalesced()
+				m.settle(false)
+			}
+			m, raw = in, in.v
+			if s.clone != nil {
+				m.v = s.clone(m.v)
+			}
+			if !pending && s.jitter > 0 {
+				delay = s.clock.After(time.Duration(rand.Int63n(int64(s.jitter))))
+			}
+			if s.maxAge > 0 {
+				expire = s.clock.After(s.maxAge - s.clock.Now().Sub(m.at))
+			}
+			pending = true // newer update
+		case <-delay:
+			delay = nil
+		case <-expire:
+			expire = nil
+			pending = false // update discarded
+			atomic.AddUint64(&s.drops, 1)
+			m.settle(false)
+			if hasNext {
+				promote()
+			}
+		case <-retry:
+			attempts++
+			if attempts < s.retries {
+				retry = s.clock.After(s.backoff)
+				break
+			}
+			// retries exhausted
+			s.coalesced()
+			m.settle(false)
+			promote()
+		case notify <- out:
+			if len(s.replay) != 0 {
+				s.replay[0] = nil // release
+				s.replay = s.replay[1:]
+				s.countDelivery()
+				break
+			}
+			expire = nil
+			pending = false // update delivered
+			s.delivery(&m, raw)
+			if hasNext {
+				promote() // delivered within retries
+			}
+		case <-idle:
+			idle = nil
+			if s.tryPark() {
+				parked = true
+				return // wake restarts
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
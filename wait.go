@@ -0,0 +1,187 @@
+package latest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// WaitFor blocks until the current version, or any update thereafter, makes
+// pred true, and it returns the respective value. The error is ctx.Err() on
+// expiry, or ErrClosed when the subscription terminates, e.g., on Close.
+func (b *Broadcast) WaitFor(ctx context.Context, pred func(interface{}) bool) (interface{}, error) {
+	notify := make(chan interface{})
+
+	b.Lock()
+	s, err := b.subscribe(notify, 0)
+	if err != nil {
+		b.Unlock()
+		return nil, err
+	}
+	s.spawn(s.run)
+	current, ok := b.latest, b.hasLatest
+	b.Unlock()
+	defer b.Unsubscribe(notify)
+
+	if ok && pred(current) {
+		return current, nil
+	}
+	for {
+		select {
+		case v := <-notify:
+			if pred(v) {
+				return v, nil
+			}
+		case <-s.done:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// LoadOrWait returns the current version, or it waits for the first Update
+// when none. The fallback applies on expiry of ctx, and after Close.
+func (b *Broadcast) LoadOrWait(ctx context.Context, fallback interface{}) interface{} {
+	if v, ok := b.Load(); ok {
+		return v
+	}
+	v, err := b.WaitFor(ctx, func(interface{}) bool { return true })
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// Wait blocks until Seq exceeds seq, and it returns the new sequence number.
+// Waiters wake once per batch of updates, after which Load or State reads the
+// current version. Wait returns without change after Close.
+//
+//	var seq uint64
+//	for {
+//		seq = b.Wait(seq)
+//		v, _ := b.Load()
+//		…
+//	}
+func (b *Broadcast) Wait(seq uint64) uint64 {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.cond == nil {
+		b.cond = sync.NewCond(&b.RWMutex)
+	}
+	// loop guards against spurious wakeups
+	for b.seq <= seq && !b.closed {
+		b.cond.Wait()
+	}
+	return b.seq
+}
+
+// LoadOrCompute returns the current version, if any. Otherwise, it sets the
+// return of compute as the current version, as with Update. Concurrent calls
+// share the computation, i.e., compute runs once at a time. A value rejected
+// by Validate, or a value computed after Close, is returned without being set.
+// When another Update happens during the computation, then that version is
+// returned instead. A panic from compute propagates, without anything set, and
+// any concurrent callers retry.
+func (b *Broadcast) LoadOrCompute(compute func() interface{}) interface{} {
+	for {
+		b.Lock()
+		if b.hasLatest {
+			v := b.latest
+			b.Unlock()
+			return v
+		}
+		if b.computing == nil {
+			break // lock held
+		}
+		c := b.computing
+		b.Unlock()
+		<-c
+	}
+
+	c := make(chan struct{})
+	b.computing = c
+	b.Unlock()
+
+	defer func() {
+		b.Lock()
+		b.computing = nil
+		b.Unlock()
+		close(c)
+	}()
+
+	v := compute()
+	if b.Validate != nil && b.Validate(v) != nil {
+		return v
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.hasLatest {
+		return b.latest
+	}
+	fanOut, err := b.set(v)
+	if err != nil {
+		return v
+	}
+	if fanOut {
+		b.each(func(s *subscription) {
+			b.send(s, message{v: v, at: b.at})
+		})
+	}
+	return v
+}
+
+// WaitIdle blocks until none of the subscriptions has a value pending, as by
+// AllCurrent, i.e., until each receiver is caught up. The error is ctx.Err() on
+// expiry, and nil otherwise.
+func (b *Broadcast) WaitIdle(ctx context.Context) error {
+	for {
+		// register before the check, such that no change goes unnoticed
+		changed := b.caughtUp.wait()
+		if b.AllCurrent() {
+			return nil
+		}
+		select {
+		case <-changed:
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// idleSignal is the WaitIdle destination.
+type idleSignal struct {
+	armed int32 // whether c is set; atomic access only
+	mutex sync.Mutex
+	c     chan struct{} // closed on emit, if any
+}
+
+// wait returns a channel which is closed on the next emit.
+func (s *idleSignal) wait() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.c == nil {
+		s.c = make(chan struct{})
+		atomic.StoreInt32(&s.armed, 1)
+	}
+	return s.c
+}
+
+// emit signals any waiters that a subscription may have caught up.
+func (s *idleSignal) emit() {
+	if s == nil || atomic.LoadInt32(&s.armed) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.c != nil {
+		close(s.c)
+		s.c = nil
+		atomic.StoreInt32(&s.armed, 0)
+	}
+}
@@ -0,0 +1,46 @@
+package latest
+
+// WatchInto updates b with the return of load each time trigger receives, as
+// in a configuration reload on file change. Triggers which arrive during a
+// load coalesce into one more load afterwards, such that bursts of change
+// events don't pile up. Errs receives load errors, without any Update in such
+// case, and errors from Update, such as a rejection by Validate. Errors are discarded while an earlier one is pending in errs, so the
+// channel may be ignored. Errs is closed once trigger is closed, or once b is
+// closed.
+func WatchInto(b *Broadcast, trigger <-chan struct{}, load func() (interface{}, error)) (errs <-chan error) {
+	wake := make(chan struct{}, 1)
+	c := make(chan error, 1)
+
+	go func() {
+		defer close(wake)
+		for range trigger {
+			select {
+			case wake <- struct{}{}:
+			default:
+				break // load pending
+			}
+		}
+	}()
+
+	go func() {
+		defer close(c)
+		for range wake {
+			v, err := load()
+			if err == nil {
+				err = b.Update(v)
+				if err == ErrClosed {
+					return
+				}
+			}
+			if err != nil {
+				select {
+				case c <- err:
+				default:
+					break // error pending
+				}
+			}
+		}
+	}()
+
+	return c
+}